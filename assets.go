@@ -0,0 +1,226 @@
+/*
+ * Copyright 2019 Aletheia Ware LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package perspectiveeditorgo
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/AletheiaWareLLC/perspectivego"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	ASSET_MESH     = "mesh"
+	ASSET_TEXTURE  = "texture"
+	ASSET_MATERIAL = "material"
+)
+
+var assetKinds = []string{ASSET_MESH, ASSET_TEXTURE, ASSET_MATERIAL}
+
+// Assets holds the names of the meshes, textures and materials available to a world.
+// An empty name means the element has none, and is always valid.
+type Assets struct {
+	Names map[string]map[string]bool
+}
+
+// AssetReport is the result of checking a world against its assets.
+type AssetReport struct {
+	// Unknown lists each reference to a missing asset, such as puzzle[2].block[b1].mesh: boxx
+	Unknown []string
+	// Usage counts the references to each name of each kind
+	Usage map[string]map[string]int
+	// Unused lists the available names of each kind which are never referenced
+	Unused map[string][]string
+}
+
+func NewAssets() *Assets {
+	a := &Assets{
+		Names: make(map[string]map[string]bool),
+	}
+	for _, k := range assetKinds {
+		a.Names[k] = make(map[string]bool)
+	}
+	return a
+}
+
+func (a *Assets) Add(kind, name string) error {
+	names, ok := a.Names[kind]
+	if !ok {
+		return errors.New("Unrecognized asset kind: " + kind)
+	}
+	names[name] = true
+	return nil
+}
+
+func (a *Assets) Has(kind, name string) bool {
+	return name == "" || a.Names[kind][name]
+}
+
+// Validate returns an error naming the first of the given names which is not available.
+func (a *Assets) Validate(kind string, names ...string) error {
+	for _, n := range names {
+		if !a.Has(kind, n) {
+			return fmt.Errorf("Unknown %s: %s", kind, n)
+		}
+	}
+	return nil
+}
+
+// ValidateStyle returns an error if any mesh, texture or material in the style is not available.
+func (a *Assets) ValidateStyle(style *ElementStyle) error {
+	if err := a.Validate(ASSET_MESH, style.Mesh...); err != nil {
+		return err
+	}
+	if err := a.Validate(ASSET_TEXTURE, style.Texture...); err != nil {
+		return err
+	}
+	return a.Validate(ASSET_MATERIAL, style.Material...)
+}
+
+// ReadAssets reads an asset directory, or an asset manifest if the path is a file.
+func ReadAssets(path string) (*Assets, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return ReadAssetDirectory(path)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadAssetManifest(file)
+}
+
+// ReadAssetManifest reads one asset per line in the form <kind>:<name>, where kind is mesh, texture or material.
+// Blank lines and lines starting with // are ignored.
+func ReadAssetManifest(reader io.Reader) (*Assets, error) {
+	assets := NewAssets()
+	scanner := bufio.NewScanner(reader)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "//") {
+			continue
+		}
+		parts := strings.SplitN(text, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Line %d: Malformed asset", line)
+		}
+		if err := assets.Add(parts[0], parts[1]); err != nil {
+			return nil, fmt.Errorf("Line %d: %s", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return assets, nil
+}
+
+// ReadAssetDirectory reads the files under the mesh, texture and material subdirectories (or their plurals),
+// naming each asset by its path relative to the subdirectory without the extension.
+func ReadAssetDirectory(directory string) (*Assets, error) {
+	assets := NewAssets()
+	for _, k := range assetKinds {
+		for _, d := range []string{k, k + "s"} {
+			root := filepath.Join(directory, d)
+			if _, err := os.Stat(root); os.IsNotExist(err) {
+				continue
+			}
+			err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if info.IsDir() {
+					return nil
+				}
+				relative, err := filepath.Rel(root, path)
+				if err != nil {
+					return err
+				}
+				name := strings.TrimSuffix(filepath.ToSlash(relative), filepath.Ext(relative))
+				return assets.Add(k, name)
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return assets, nil
+}
+
+// CheckWorldAssets reports the unknown, used and unused assets of the world.
+func CheckWorldAssets(world *perspectivego.World, assets *Assets) *AssetReport {
+	report := &AssetReport{
+		Usage:  make(map[string]map[string]int),
+		Unused: make(map[string][]string),
+	}
+	for _, k := range assetKinds {
+		report.Usage[k] = make(map[string]int)
+	}
+	use := func(path, mesh, texture, material string) {
+		for _, u := range [][2]string{{ASSET_MESH, mesh}, {ASSET_TEXTURE, texture}, {ASSET_MATERIAL, material}} {
+			if u[1] == "" {
+				continue
+			}
+			report.Usage[u[0]][u[1]]++
+			if !assets.Has(u[0], u[1]) {
+				report.Unknown = append(report.Unknown, path+"."+u[0]+": "+u[1])
+			}
+		}
+	}
+	for i, p := range world.Puzzle {
+		path := fmt.Sprintf("puzzle[%d]", i)
+		if o := p.Outline; o != nil {
+			use(path+".outline", o.Mesh, o.Texture, o.Material)
+		}
+		for _, b := range p.Block {
+			use(path+".block["+b.Name+"]", b.Mesh, b.Texture, b.Material)
+		}
+		for _, g := range p.Goal {
+			use(path+".goal["+g.Name+"]", g.Mesh, g.Texture, g.Material)
+		}
+		for _, o := range p.Portal {
+			use(path+".portal["+o.Name+"]", o.Mesh, o.Texture, o.Material)
+		}
+		for _, s := range p.Sphere {
+			use(path+".sphere["+s.Name+"]", s.Mesh, s.Texture, s.Material)
+		}
+	}
+	for _, k := range assetKinds {
+		for n := range assets.Names[k] {
+			if report.Usage[k][n] == 0 {
+				report.Unused[k] = append(report.Unused[k], n)
+			}
+		}
+		sort.Strings(report.Unused[k])
+	}
+	return report
+}
+
+// AssetKinds returns the kinds of asset in the order they are reported.
+func AssetKinds() []string {
+	return append([]string{}, assetKinds...)
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright 2019 Aletheia Ware LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package perspectiveeditorgo
+
+import (
+	"github.com/AletheiaWareLLC/perspectivego"
+)
+
+// Bounds models, deciding what happens when the sphere reaches the edge of the world
+const (
+	// BOUNDS_LEGACY falls off once a coordinate exceeds the size, twice the world's extent, as Score always has
+	BOUNDS_LEGACY = "legacy"
+	// BOUNDS_FALL falls off on leaving the world's extent, as in game
+	BOUNDS_FALL = "fall"
+	// BOUNDS_WALL stops the sphere against the outline, as if it were lined with blocks
+	BOUNDS_WALL = "wall"
+	// BOUNDS_WRAP moves the sphere leaving one side of the world onto the opposite side
+	BOUNDS_WRAP = "wrap"
+)
+
+// Bounds is the extent of the world, from Min to Max inclusive on each of the X, Y and Z axes, and the model applied at its edge.
+type Bounds struct {
+	Model string
+	Min   [3]int32
+	Max   [3]int32
+}
+
+// NewBounds returns bounds of the given model for a cubic world of the given size.
+func NewBounds(model string, size uint32) (*Bounds, error) {
+	return CubeVolume(size).Bounds(model)
+}
+
+// LegacyBounds returns bounds which the sphere falls off once a coordinate exceeds the size.
+func LegacyBounds(size uint32) *Bounds {
+	bounds, _ := CubeVolume(size).Bounds(BOUNDS_LEGACY)
+	return bounds
+}
+
+// BoundsModels returns the names of the bounds models.
+func BoundsModels() []string {
+	return []string{BOUNDS_LEGACY, BOUNDS_FALL, BOUNDS_WALL, BOUNDS_WRAP}
+}
+
+func (b *Bounds) Contains(location *perspectivego.Location) bool {
+	for i, c := range []int32{location.X, location.Y, location.Z} {
+		if c < b.Min[i] || c > b.Max[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Next returns the cell the sphere at the given location moves into under the given gravity, whether that is possible, and whether the sphere wrapped around.
+// The sphere cannot move through a wall, and under the falling models the returned cell may lie outside the bounds.
+func (b *Bounds) Next(location, direction *perspectivego.Location) (*perspectivego.Location, bool, bool) {
+	next := &perspectivego.Location{
+		X: location.X + direction.X,
+		Y: location.Y + direction.Y,
+		Z: location.Z + direction.Z,
+	}
+	if b.Model != BOUNDS_WALL && b.Model != BOUNDS_WRAP {
+		return next, true, false
+	}
+	wrapped := false
+	for i, c := range []*int32{&next.X, &next.Y, &next.Z} {
+		switch {
+		case *c < b.Min[i]:
+			*c = b.Max[i]
+		case *c > b.Max[i]:
+			*c = b.Min[i]
+		default:
+			continue
+		}
+		if b.Model == BOUNDS_WALL {
+			return nil, false, false
+		}
+		wrapped = true
+	}
+	return next, true, wrapped
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright 2019 Aletheia Ware LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package perspectiveeditorgo
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CHECKPOINT_INTERVAL is the number of iterations between periodic checkpoints
+const CHECKPOINT_INTERVAL = 1000000
+
+// Checkpoint holds the state of a generation run so it can be resumed.
+// Iteration i of a run generates its puzzle from Seed + i, so Seed and Iteration together capture the random number generator state.
+type Checkpoint struct {
+	Seed      int64
+	Iteration int
+	Elapsed   time.Duration
+	// Accepted is the number of puzzles kept so far
+	Accepted int
+	// Improved is the last iteration in which a puzzle was kept
+	Improved int
+	// Best maps each score to the lowest penalty found for it
+	Best map[int]int
+}
+
+func NewCheckpoint(seed int64) *Checkpoint {
+	return &Checkpoint{
+		Seed: seed,
+		Best: make(map[int]int),
+	}
+}
+
+// IterationSeed returns the seed used to generate the puzzle of the given iteration.
+func (c *Checkpoint) IterationSeed(iteration int) int64 {
+	return c.Seed + int64(iteration)
+}
+
+func ReadCheckpointFile(path string) (*Checkpoint, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadCheckpoint(file)
+}
+
+func ReadCheckpoint(reader io.Reader) (*Checkpoint, error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Split(bufio.ScanLines)
+
+	checkpoint := NewCheckpoint(0)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.Split(line, ":")
+		if len(parts) < 2 {
+			return nil, errors.New("Malformed line: " + line)
+		}
+		switch parts[0] {
+		case "seed":
+			seed, err := strconv.ParseInt(parts[1], 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			checkpoint.Seed = seed
+		case "iteration":
+			iteration, err := strconv.Atoi(parts[1])
+			if err != nil {
+				return nil, err
+			}
+			checkpoint.Iteration = iteration
+		case "elapsed":
+			elapsed, err := time.ParseDuration(parts[1])
+			if err != nil {
+				return nil, err
+			}
+			checkpoint.Elapsed = elapsed
+		case "accepted":
+			accepted, err := strconv.Atoi(parts[1])
+			if err != nil {
+				return nil, err
+			}
+			checkpoint.Accepted = accepted
+		case "improved":
+			improved, err := strconv.Atoi(parts[1])
+			if err != nil {
+				return nil, err
+			}
+			checkpoint.Improved = improved
+		case "best":
+			if len(parts) != 3 {
+				return nil, errors.New("Malformed best: " + line)
+			}
+			score, err := strconv.Atoi(parts[1])
+			if err != nil {
+				return nil, err
+			}
+			penalty, err := strconv.Atoi(parts[2])
+			if err != nil {
+				return nil, err
+			}
+			checkpoint.Best[score] = penalty
+		default:
+			return nil, errors.New("Unrecognized line: " + line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return checkpoint, nil
+}
+
+// WriteCheckpointFile writes the checkpoint to a temporary file which is then renamed over the given path, so an interrupted write never corrupts an existing checkpoint.
+func WriteCheckpointFile(path string, checkpoint *Checkpoint) error {
+	temp := path + ".tmp"
+	file, err := os.OpenFile(temp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	if err := WriteCheckpoint(file, checkpoint); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp, path)
+}
+
+func WriteCheckpoint(writer io.Writer, checkpoint *Checkpoint) error {
+	if _, err := fmt.Fprintln(writer, "seed:"+strconv.FormatInt(checkpoint.Seed, 10)); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(writer, "iteration:"+strconv.Itoa(checkpoint.Iteration)); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(writer, "elapsed:"+checkpoint.Elapsed.String()); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(writer, "accepted:"+strconv.Itoa(checkpoint.Accepted)); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(writer, "improved:"+strconv.Itoa(checkpoint.Improved)); err != nil {
+		return err
+	}
+	scores := make([]int, 0, len(checkpoint.Best))
+	for s := range checkpoint.Best {
+		scores = append(scores, s)
+	}
+	sort.Ints(scores)
+	for _, s := range scores {
+		if _, err := fmt.Fprintln(writer, "best:"+strconv.Itoa(s)+":"+strconv.Itoa(checkpoint.Best[s])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
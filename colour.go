@@ -0,0 +1,427 @@
+/*
+ * Copyright 2019 Aletheia Ware LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package perspectiveeditorgo
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/AletheiaWareLLC/perspectivego"
+	"image/color"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MIN_CONTRAST is the lowest acceptable contrast ratio between an element and the background, as for non-text content in WCAG 2.1
+	MIN_CONTRAST = 3.0
+	// MIN_COLOUR_DISTANCE is the lowest acceptable CIE76 distance between the colours of different elements
+	MIN_COLOUR_DISTANCE = 20.0
+)
+
+const (
+	VISION_NORMAL       = "normal vision"
+	VISION_PROTANOPIA   = "protanopia"
+	VISION_DEUTERANOPIA = "deuteranopia"
+	VISION_TRITANOPIA   = "tritanopia"
+)
+
+// Theme is a named colour scheme applied to a world by element role.
+// Each element list is cycled through like Generate, with portals advancing once per pair, and an empty list leaves that role unchanged.
+type Theme struct {
+	Name       string
+	Foreground string
+	Background string
+	Outline    string
+	Goal       []string
+	Sphere     []string
+	Block      []string
+	Portal     []string
+}
+
+var namedColours = map[string]color.NRGBA{
+	"black":   {0x00, 0x00, 0x00, 0xff},
+	"white":   {0xff, 0xff, 0xff, 0xff},
+	"grey":    {0x80, 0x80, 0x80, 0xff},
+	"gray":    {0x80, 0x80, 0x80, 0xff},
+	"silver":  {0xc0, 0xc0, 0xc0, 0xff},
+	"red":     {0xff, 0x00, 0x00, 0xff},
+	"maroon":  {0x80, 0x00, 0x00, 0xff},
+	"orange":  {0xff, 0xa5, 0x00, 0xff},
+	"yellow":  {0xff, 0xff, 0x00, 0xff},
+	"olive":   {0x80, 0x80, 0x00, 0xff},
+	"lime":    {0x00, 0xff, 0x00, 0xff},
+	"green":   {0x00, 0x80, 0x00, 0xff},
+	"teal":    {0x00, 0x80, 0x80, 0xff},
+	"cyan":    {0x00, 0xff, 0xff, 0xff},
+	"aqua":    {0x00, 0xff, 0xff, 0xff},
+	"blue":    {0x00, 0x00, 0xff, 0xff},
+	"navy":    {0x00, 0x00, 0x80, 0xff},
+	"purple":  {0x80, 0x00, 0x80, 0xff},
+	"magenta": {0xff, 0x00, 0xff, 0xff},
+	"fuchsia": {0xff, 0x00, 0xff, 0xff},
+	"pink":    {0xff, 0xc0, 0xcb, 0xff},
+	"brown":   {0xa5, 0x2a, 0x2a, 0xff},
+}
+
+// themes are built in, with element colours chosen to pass ContrastWarnings
+var themes = map[string]*Theme{
+	"dark": {
+		Name:       "dark",
+		Foreground: "white",
+		Background: "black",
+		Outline:    "white",
+		Goal:       []string{"#33ff66"},
+		Sphere:     []string{"white"},
+		Block:      []string{"#666666"},
+		Portal:     []string{"#ffff33", "#ff3399", "#6666cc", "#cc9900"},
+	},
+	"light": {
+		Name:       "light",
+		Foreground: "black",
+		Background: "white",
+		Outline:    "black",
+		Goal:       []string{"#009933"},
+		Sphere:     []string{"black"},
+		Block:      []string{"#333333"},
+		Portal:     []string{"#9900ff", "#330033", "#663300", "#003399"},
+	},
+}
+
+// protanopia, deuteranopia and tritanopia simulations from Machado, Oliveira and Fernandes (2009) at full severity, applied to linear RGB
+var visions = []struct {
+	Name   string
+	Matrix [3][3]float64
+}{
+	{VISION_NORMAL, [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}},
+	{VISION_PROTANOPIA, [3][3]float64{{0.152286, 1.052583, -0.204868}, {0.114503, 0.786281, 0.099216}, {-0.003882, -0.048116, 1.051998}}},
+	{VISION_DEUTERANOPIA, [3][3]float64{{0.367322, 0.860646, -0.227968}, {0.280085, 0.672501, 0.047413}, {-0.011820, 0.042940, 0.968881}}},
+	{VISION_TRITANOPIA, [3][3]float64{{1.255528, -0.076749, -0.178779}, {-0.078411, 0.930809, 0.147602}, {0.004733, 0.691367, 0.303900}}},
+}
+
+// ParseColour parses a named colour, or a hex colour in the form #RGB, #RRGGBB or #RRGGBBAA.
+func ParseColour(s string) (color.NRGBA, error) {
+	name := strings.ToLower(strings.TrimSpace(s))
+	if c, ok := namedColours[name]; ok {
+		return c, nil
+	}
+	if strings.HasPrefix(name, "#") {
+		hex := name[1:]
+		if len(hex) == 3 {
+			hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+		}
+		if len(hex) == 6 {
+			hex += "ff"
+		}
+		if len(hex) == 8 {
+			v, err := strconv.ParseUint(hex, 16, 32)
+			if err == nil {
+				return color.NRGBA{
+					R: uint8(v >> 24),
+					G: uint8(v >> 16),
+					B: uint8(v >> 8),
+					A: uint8(v),
+				}, nil
+			}
+		}
+	}
+	return color.NRGBA{}, errors.New("Unrecognized colour: " + s)
+}
+
+// FormatColour returns the colour as #RRGGBB, or #RRGGBBAA if it is not opaque.
+func FormatColour(c color.NRGBA) string {
+	if c.A == 0xff {
+		return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	}
+	return fmt.Sprintf("#%02x%02x%02x%02x", c.R, c.G, c.B, c.A)
+}
+
+// ThemeNames returns the sorted names of the built-in themes.
+func ThemeNames() []string {
+	var names []string
+	for n := range themes {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetTheme returns the built-in theme with the given name, or reads a theme file if there is no such theme.
+func GetTheme(name string) (*Theme, error) {
+	if t, ok := themes[name]; ok {
+		return t, nil
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, errors.New("Unrecognized theme: " + name)
+	}
+	defer file.Close()
+	return ReadTheme(file)
+}
+
+// ReadTheme reads a theme with one <key>:<value> line each for name, foreground, background and outline,
+// and one <role>:<colour...> line each for goal, sphere, block and portal, with colours separated by commas.
+func ReadTheme(reader io.Reader) (*Theme, error) {
+	theme := &Theme{}
+	scanner := bufio.NewScanner(reader)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "//") {
+			continue
+		}
+		parts := strings.SplitN(text, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Line %d: Malformed theme", line)
+		}
+		switch parts[0] {
+		case "name":
+			theme.Name = parts[1]
+		case "foreground":
+			theme.Foreground = parts[1]
+		case "background":
+			theme.Background = parts[1]
+		case "outline":
+			theme.Outline = parts[1]
+		case "goal":
+			theme.Goal = strings.Split(parts[1], ",")
+		case "sphere":
+			theme.Sphere = strings.Split(parts[1], ",")
+		case "block":
+			theme.Block = strings.Split(parts[1], ",")
+		case "portal":
+			theme.Portal = strings.Split(parts[1], ",")
+		default:
+			return nil, fmt.Errorf("Line %d: Unrecognized key: %s", line, parts[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := theme.Validate(); err != nil {
+		return nil, err
+	}
+	return theme, nil
+}
+
+// Validate returns an error if any colour of the theme cannot be parsed.
+func (t *Theme) Validate() error {
+	colours := []string{t.Foreground, t.Background, t.Outline}
+	for _, l := range [][]string{t.Goal, t.Sphere, t.Block, t.Portal} {
+		colours = append(colours, l...)
+	}
+	for _, c := range colours {
+		if c == "" {
+			continue
+		}
+		if _, err := ParseColour(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplyTheme recolours the world and every puzzle in it with the theme.
+func ApplyTheme(world *perspectivego.World, theme *Theme) {
+	if theme.Foreground != "" {
+		world.ForegroundColour = theme.Foreground
+	}
+	if theme.Background != "" {
+		world.BackgroundColour = theme.Background
+	}
+	for _, p := range world.Puzzle {
+		if p.Outline != nil && theme.Outline != "" {
+			p.Outline.Colour = theme.Outline
+		}
+		if len(theme.Goal) > 0 {
+			for i, g := range p.Goal {
+				g.Colour = theme.Goal[i%len(theme.Goal)]
+			}
+		}
+		if len(theme.Sphere) > 0 {
+			for i, s := range p.Sphere {
+				s.Colour = theme.Sphere[i%len(theme.Sphere)]
+			}
+		}
+		if len(theme.Block) > 0 {
+			for i, b := range p.Block {
+				b.Colour = theme.Block[i%len(theme.Block)]
+			}
+		}
+		if len(theme.Portal) > 0 {
+			for i, o := range p.Portal {
+				o.Colour = theme.Portal[(i/2)%len(theme.Portal)]
+			}
+		}
+	}
+}
+
+// CheckWorldColours returns the colours of the world which cannot be parsed, and warnings for goal, block and portal colours
+// which are too close to the background or to each other under normal vision and each colour-blindness simulation.
+func CheckWorldColours(world *perspectivego.World) ([]string, []string) {
+	var invalid []string
+	check := func(path, colour string) {
+		if _, err := ParseColour(colour); err != nil {
+			invalid = append(invalid, path+": "+err.Error())
+		}
+	}
+	check("foreground_colour", world.ForegroundColour)
+	check("background_colour", world.BackgroundColour)
+	roles := make(map[string]map[string]bool)
+	for _, r := range []string{"goal", "block", "portal"} {
+		roles[r] = make(map[string]bool)
+	}
+	for i, p := range world.Puzzle {
+		path := fmt.Sprintf("puzzle[%d]", i)
+		if p.Outline != nil {
+			check(path+".outline", p.Outline.Colour)
+		}
+		for _, b := range p.Block {
+			check(path+".block["+b.Name+"]", b.Colour)
+			roles["block"][b.Colour] = true
+		}
+		for _, g := range p.Goal {
+			check(path+".goal["+g.Name+"]", g.Colour)
+			roles["goal"][g.Colour] = true
+		}
+		for _, o := range p.Portal {
+			check(path+".portal["+o.Name+"]", o.Colour)
+			roles["portal"][o.Colour] = true
+		}
+		for _, s := range p.Sphere {
+			check(path+".sphere["+s.Name+"]", s.Colour)
+		}
+	}
+	if len(invalid) > 0 {
+		return invalid, nil
+	}
+	goal, block, portal := sortedColours(roles["goal"]), sortedColours(roles["block"]), sortedColours(roles["portal"])
+	return nil, ContrastWarnings(world.BackgroundColour, goal, block, portal)
+}
+
+// ContrastWarnings compares each goal, block and portal colour with the background, and with the colours of the other roles and the other portal pairs.
+// All colours must be parseable.
+func ContrastWarnings(background string, goal, block, portal []string) []string {
+	type entry struct {
+		role, colour string
+	}
+	var entries []entry
+	for _, c := range goal {
+		entries = append(entries, entry{"Goal", c})
+	}
+	for _, c := range block {
+		entries = append(entries, entry{"Block", c})
+	}
+	for _, c := range portal {
+		entries = append(entries, entry{"Portal", c})
+	}
+	bg, _ := ParseColour(background)
+	var warnings []string
+	for _, v := range visions {
+		b := SimulateVision(bg, v.Matrix)
+		for i, e := range entries {
+			c, _ := ParseColour(e.colour)
+			c = SimulateVision(c, v.Matrix)
+			if r := ContrastRatio(c, b); r < MIN_CONTRAST {
+				warnings = append(warnings, fmt.Sprintf("%s colour %s is too close to background %s under %s (contrast %.2f)", e.role, e.colour, background, v.Name, r))
+			}
+			for _, o := range entries[i+1:] {
+				if e.role == o.role && e.role != "Portal" {
+					continue
+				}
+				d, _ := ParseColour(o.colour)
+				d = SimulateVision(d, v.Matrix)
+				if distance := ColourDistance(c, d); distance < MIN_COLOUR_DISTANCE {
+					warnings = append(warnings, fmt.Sprintf("%s colour %s is too close to %s colour %s under %s (distance %.1f)", e.role, e.colour, strings.ToLower(o.role), o.colour, v.Name, distance))
+				}
+			}
+		}
+	}
+	return warnings
+}
+
+// ContrastRatio returns the WCAG contrast ratio of two colours, from 1 to 21.
+func ContrastRatio(a, b color.NRGBA) float64 {
+	la, lb := RelativeLuminance(a), RelativeLuminance(b)
+	if la < lb {
+		la, lb = lb, la
+	}
+	return (la + 0.05) / (lb + 0.05)
+}
+
+func RelativeLuminance(c color.NRGBA) float64 {
+	r, g, b := linearRGB(c)
+	return 0.2126*r + 0.7152*g + 0.0722*b
+}
+
+// ColourDistance returns the CIE76 distance between two colours in CIELAB space.
+func ColourDistance(a, b color.NRGBA) float64 {
+	l1, a1, b1 := lab(a)
+	l2, a2, b2 := lab(b)
+	return math.Sqrt((l1-l2)*(l1-l2) + (a1-a2)*(a1-a2) + (b1-b2)*(b1-b2))
+}
+
+// SimulateVision returns the colour as seen through the given linear RGB transform.
+func SimulateVision(c color.NRGBA, m [3][3]float64) color.NRGBA {
+	r, g, b := linearRGB(c)
+	v := [3]float64{r, g, b}
+	var out [3]uint8
+	for i := range out {
+		x := m[i][0]*v[0] + m[i][1]*v[1] + m[i][2]*v[2]
+		out[i] = uint8(math.Round(255 * toSRGB(math.Max(0, math.Min(1, x)))))
+	}
+	return color.NRGBA{out[0], out[1], out[2], c.A}
+}
+
+func linearRGB(c color.NRGBA) (float64, float64, float64) {
+	return toLinear(float64(c.R) / 255), toLinear(float64(c.G) / 255), toLinear(float64(c.B) / 255)
+}
+
+func toLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func toSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+func lab(c color.NRGBA) (float64, float64, float64) {
+	r, g, b := linearRGB(c)
+	// D65 reference white
+	x := (0.4124*r + 0.3576*g + 0.1805*b) / 0.95047
+	y := 0.2126*r + 0.7152*g + 0.0722*b
+	z := (0.0193*r + 0.1192*g + 0.9505*b) / 1.08883
+	f := func(t float64) float64 {
+		if t > 0.008856 {
+			return math.Cbrt(t)
+		}
+		return 7.787*t + 16.0/116
+	}
+	fx, fy, fz := f(x), f(y), f(z)
+	return 116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)
+}
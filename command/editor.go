@@ -17,6 +17,7 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
 	"github.com/AletheiaWareLLC/joygo"
 	"github.com/AletheiaWareLLC/perspectiveeditorgo"
@@ -26,9 +27,12 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 )
 
@@ -38,7 +42,7 @@ func main() {
 	if len(os.Args) > 1 {
 		switch os.Args[1] {
 		case "create-world":
-			if len(os.Args) > 4 {
+			if len(os.Args) > 5 {
 				name := os.Args[2]
 				size, err := strconv.Atoi(os.Args[3])
 				if err != nil {
@@ -51,7 +55,13 @@ func main() {
 					log.Fatal("World size must be odd")
 				}
 				foreground := os.Args[4]
+				if _, err := perspectiveeditorgo.ParseColour(foreground); err != nil {
+					log.Fatal("Foreground ", err)
+				}
 				background := os.Args[5]
+				if _, err := perspectiveeditorgo.ParseColour(background); err != nil {
+					log.Fatal("Background ", err)
+				}
 				world := &perspectivego.World{
 					Name:             name,
 					Size:             uint32(size),
@@ -86,6 +96,217 @@ func main() {
 			} else {
 				log.Println("show-world <world>")
 			}
+		case "unpack-world":
+			if len(os.Args) > 3 {
+				data, err := perspectiveeditorgo.ReadWorldData(os.Args[2])
+				if err != nil {
+					log.Fatal(err)
+				}
+				if err := perspectiveeditorgo.UnpackWorld(data, os.Args[3]); err != nil {
+					log.Fatal(err)
+				}
+			} else {
+				log.Println("unpack-world <world> <directory>")
+			}
+		case "pack-world":
+			if len(os.Args) > 3 {
+				data, err := perspectiveeditorgo.PackWorld(os.Args[2])
+				if err != nil {
+					log.Fatal(err)
+				}
+				log.Println("Writing:", os.Args[3])
+				file, err := os.OpenFile(os.Args[3], os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.ModePerm)
+				if err != nil {
+					log.Fatal(err)
+				}
+				defer file.Close()
+				if err := perspectiveeditorgo.WriteWorldData(file, data); err != nil {
+					log.Fatal(err)
+				}
+			} else {
+				log.Println("pack-world <directory> <world>")
+			}
+		case "merge-worlds":
+			if len(os.Args) > 3 {
+				var worlds []*perspectivego.World
+				for _, p := range os.Args[3:] {
+					world, err := perspectivego.ReadWorldFile(p)
+					if err != nil {
+						log.Fatal(err)
+					}
+					worlds = append(worlds, world)
+				}
+				world, duplicates, err := perspectiveeditorgo.MergeWorlds(worlds)
+				if err != nil {
+					log.Fatal(err)
+				}
+				for _, d := range duplicates {
+					log.Println("Skipping:", d)
+				}
+				log.Println("Puzzles:", len(world.Puzzle))
+				log.Println("Shaders:", len(world.Shader))
+				log.Println("Writing:", os.Args[2])
+				if err := perspectivego.WriteWorldFile(os.Args[2], world); err != nil {
+					log.Fatal(err)
+				}
+			} else {
+				log.Println("merge-worlds <output> <world...>")
+			}
+		case "split-world":
+			var ranges, description, minTarget, maxTarget string
+			os.Args, ranges = ExtractOption(os.Args, "--range")
+			os.Args, description = ExtractOption(os.Args, "--description")
+			os.Args, minTarget = ExtractOption(os.Args, "--min-target")
+			os.Args, maxTarget = ExtractOption(os.Args, "--max-target")
+			if len(os.Args) > 3 {
+				world, err := perspectivego.ReadWorldFile(os.Args[2])
+				if err != nil {
+					log.Fatal(err)
+				}
+				included := func(int) bool { return true }
+				if ranges != "" {
+					included, err = perspectiveeditorgo.ParseRanges(ranges)
+					if err != nil {
+						log.Fatal(err)
+					}
+				}
+				min, max := 0, -1
+				if minTarget != "" {
+					min = ParseCount("--min-target", minTarget)
+				}
+				if maxTarget != "" {
+					max = ParseCount("--max-target", maxTarget)
+				}
+				split := perspectiveeditorgo.SplitWorld(world, func(i int, p *perspectivego.Puzzle) bool {
+					if !included(i) {
+						return false
+					}
+					if description != "" && !strings.Contains(p.Description, description) {
+						return false
+					}
+					if int(p.Target) < min || (max >= 0 && int(p.Target) > max) {
+						return false
+					}
+					return true
+				})
+				log.Println("Puzzles:", len(split.Puzzle))
+				log.Println("Shaders:", len(split.Shader))
+				log.Println("Writing:", os.Args[3])
+				if err := perspectivego.WriteWorldFile(os.Args[3], split); err != nil {
+					log.Fatal(err)
+				}
+			} else {
+				log.Println("split-world [--range <ranges>] [--description <text>] [--min-target <score>] [--max-target <score>] <world> <output>")
+			}
+		case "check-colours":
+			if len(os.Args) > 2 {
+				world, err := perspectivego.ReadWorldFile(os.Args[2])
+				if err != nil {
+					log.Fatal(err)
+				}
+				invalid, warnings := perspectiveeditorgo.CheckWorldColours(world)
+				for _, w := range warnings {
+					log.Println("Warning:", w)
+				}
+				for _, i := range invalid {
+					log.Println("Invalid:", i)
+				}
+				if len(invalid) > 0 {
+					log.Fatal(len(invalid), " invalid colours")
+				}
+			} else {
+				log.Println("check-colours <world>")
+			}
+		case "apply-theme":
+			if len(os.Args) > 3 {
+				path := os.Args[2]
+				world, err := perspectivego.ReadWorldFile(path)
+				if err != nil {
+					log.Fatal(err)
+				}
+				theme, err := perspectiveeditorgo.GetTheme(os.Args[3])
+				if err != nil {
+					log.Fatal(err)
+				}
+				perspectiveeditorgo.ApplyTheme(world, theme)
+				_, warnings := perspectiveeditorgo.CheckWorldColours(world)
+				for _, w := range warnings {
+					log.Println("Warning:", w)
+				}
+				if err := perspectivego.WriteWorldFile(path, world); err != nil {
+					log.Fatal(err)
+				}
+			} else {
+				log.Println("apply-theme <world> <theme>")
+				log.Println("Themes:", strings.Join(perspectiveeditorgo.ThemeNames(), ", "), "or a theme file")
+			}
+		case "check-assets":
+			if len(os.Args) > 3 {
+				assets, err := perspectiveeditorgo.ReadAssets(os.Args[2])
+				if err != nil {
+					log.Fatal(err)
+				}
+				world, err := perspectivego.ReadWorldFile(os.Args[3])
+				if err != nil {
+					log.Fatal(err)
+				}
+				report := perspectiveeditorgo.CheckWorldAssets(world, assets)
+				for _, k := range perspectiveeditorgo.AssetKinds() {
+					usage := report.Usage[k]
+					var names []string
+					for n := range usage {
+						names = append(names, n)
+					}
+					sort.Strings(names)
+					for _, n := range names {
+						log.Println("Usage:", k, n, usage[n])
+					}
+					for _, n := range report.Unused[k] {
+						log.Println("Unused:", k, n)
+					}
+				}
+				for _, u := range report.Unknown {
+					log.Println("Unknown:", u)
+				}
+				if len(report.Unknown) > 0 {
+					log.Fatal(len(report.Unknown), " unknown asset references")
+				}
+			} else {
+				log.Println("check-assets <directory|manifest> <world>")
+			}
+		case "diff-world":
+			if len(os.Args) > 3 {
+				old, err := perspectivego.ReadWorldFile(os.Args[2])
+				if err != nil {
+					log.Fatal(err)
+				}
+				new, err := perspectivego.ReadWorldFile(os.Args[3])
+				if err != nil {
+					log.Fatal(err)
+				}
+				for _, d := range perspectiveeditorgo.DiffWorlds(old, new) {
+					fmt.Println(d)
+				}
+			} else {
+				log.Println("diff-world <old-world> <new-world>")
+			}
+		case "diff-puzzle":
+			if len(os.Args) > 4 {
+				size := ParseSize(os.Args[2])
+				old, err := perspectiveeditorgo.ReadPuzzleFile(os.Args[3])
+				if err != nil {
+					log.Fatal(err)
+				}
+				new, err := perspectiveeditorgo.ReadPuzzleFile(os.Args[4])
+				if err != nil {
+					log.Fatal(err)
+				}
+				for _, d := range perspectiveeditorgo.DiffPuzzles("puzzle", old, new, uint32(size), uint32(size)) {
+					fmt.Println(d)
+				}
+			} else {
+				log.Println("diff-puzzle <size> <old-puzzle> <new-puzzle>")
+			}
 		case "add-shader":
 			if len(os.Args) > 7 {
 				path := os.Args[2]
@@ -121,6 +342,8 @@ func main() {
 				log.Println("add-shader <world> <name> <attributes> <uniforms> <vertex-source-file> <fragment-source-file>")
 			}
 		case "add-puzzle":
+			var format string
+			os.Args, format = ExtractOption(os.Args, "--format")
 			if len(os.Args) > 2 {
 				path := os.Args[2]
 				world, err := perspectivego.ReadWorldFile(path)
@@ -135,27 +358,107 @@ func main() {
 					}
 					reader = file
 				}
-				puzzle, err := perspectivego.ReadPuzzle(reader)
+				var puzzle *perspectivego.Puzzle
+				switch format {
+				case "", "text":
+					puzzle, err = perspectivego.ReadPuzzle(reader)
+				case "json":
+					puzzle, err = perspectiveeditorgo.ReadPuzzleJSON(reader)
+				case "slices":
+					var size uint32
+					puzzle, size, err = perspectiveeditorgo.ReadSlices(reader, nil)
+					if err == nil && size != world.Size {
+						log.Fatal("Puzzle size does not match world size")
+					}
+				default:
+					log.Fatal("Unrecognized format: " + format)
+				}
+				if err != nil {
+					log.Fatal(err)
+				}
+				if err := perspectiveeditorgo.CheckGamePuzzle(puzzle); err != nil {
+					log.Fatal(err)
+				}
 				world.Puzzle = append(world.Puzzle, puzzle)
 				if err := perspectivego.WriteWorldFile(path, world); err != nil {
 					log.Fatal(err)
 				}
 			} else {
-				log.Println("add-puzzle <world> (read from stdin)")
-				log.Println("add-puzzle <world> <file>")
+				log.Println("add-puzzle [--format <text|json|slices>] <world> (read from stdin)")
+				log.Println("add-puzzle [--format <text|json|slices>] <world> <file>")
 			}
-		case "generate-puzzle":
-			if len(os.Args) > 33 {
-				size, err := strconv.Atoi(os.Args[2])
+		case "export-world":
+			var format string
+			os.Args, format = ExtractOption(os.Args, "--format")
+			if len(os.Args) > 2 {
+				world, err := perspectivego.ReadWorldFile(os.Args[2])
 				if err != nil {
 					log.Fatal(err)
 				}
-				if size < 0 {
-					log.Fatal("World size must be postive")
+				writer := os.Stdout
+				if len(os.Args) > 3 {
+					log.Println("Writing:", os.Args[3])
+					file, err := os.OpenFile(os.Args[3], os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.ModePerm)
+					if err != nil {
+						log.Fatal(err)
+					}
+					defer file.Close()
+					writer = file
 				}
-				if size%2 == 0 {
-					log.Fatal("World size must be odd")
+				switch format {
+				case "", "json":
+					err = perspectiveeditorgo.WriteWorldJSON(writer, world)
+				case "text":
+					_, err = fmt.Fprint(writer, proto.MarshalTextString(world))
+				default:
+					log.Fatal("Unrecognized format: " + format)
+				}
+				if err != nil {
+					log.Fatal(err)
+				}
+			} else {
+				log.Println("export-world [--format <json|text>] <world> (write to stdout)")
+				log.Println("export-world [--format <json|text>] <world> <output>")
+			}
+		case "import-world":
+			if len(os.Args) > 2 {
+				reader := os.Stdin
+				if len(os.Args) > 3 {
+					file, err := os.Open(os.Args[3])
+					if err != nil {
+						log.Fatal(err)
+					}
+					defer file.Close()
+					reader = file
+				}
+				world, err := perspectiveeditorgo.ReadWorldJSON(reader)
+				if err != nil {
+					log.Fatal(err)
 				}
+				if err := perspectiveeditorgo.CheckGameWorld(world); err != nil {
+					log.Fatal(err)
+				}
+				if err := perspectivego.WriteWorldFile(os.Args[2], world); err != nil {
+					log.Fatal(err)
+				}
+			} else {
+				log.Println("import-world <world> (read json from stdin)")
+				log.Println("import-world <world> <file>")
+			}
+		case "generate-puzzle":
+			var checkpointPath, progressMode, progressInterval, progressOutput, assetsPath string
+			var resume bool
+			os.Args, assetsPath = ExtractOption(os.Args, "--assets")
+			os.Args, checkpointPath = ExtractOption(os.Args, "--checkpoint")
+			os.Args, resume = ExtractFlag(os.Args, "--resume")
+			os.Args, progressMode = ExtractOption(os.Args, "--progress")
+			os.Args, progressInterval = ExtractOption(os.Args, "--progress-interval")
+			os.Args, progressOutput = ExtractOption(os.Args, "--progress-output")
+			budget := ExtractBudget()
+			topology := ExtractTopology()
+			scorer, _, _ := ExtractScorer()
+			if len(os.Args) > 33 {
+				volume := ParseVolume(os.Args[2])
 				score, err := strconv.Atoi(os.Args[3])
 				if err != nil {
 					log.Fatal(err)
@@ -197,8 +500,11 @@ func main() {
 				if err != nil {
 					log.Fatal("Portal count error:", err)
 				}
-				if portalCount%2 != 0 {
-					log.Fatal("Portal count must be even")
+				if err := topology.Validate(portalCount); err != nil {
+					log.Fatal(err)
+				}
+				if goalCount+sphereCount+blockCount+portalCount > volume.Cells() {
+					log.Fatal("Element count exceeds the " + volume.String() + " volume")
 				}
 				portalMesh := strings.Split(os.Args[29], ",")
 				portalColour := strings.Split(os.Args[30], ",")
@@ -223,57 +529,191 @@ func main() {
 				if outline != nil {
 					puzzle.Outline = outline
 				}
-				start := time.Now()
+				roles := []string{"Goal", "Sphere", "Block", "Portal"}
+				counts := []int{goalCount, sphereCount, blockCount, portalCount}
+				styles := []*perspectiveeditorgo.ElementStyle{
+					{Mesh: goalMesh, Colour: goalColour, Texture: goalTexture, Material: goalMaterial, Shader: goalShader},
+					{Mesh: sphereMesh, Colour: sphereColour, Texture: sphereTexture, Material: sphereMaterial, Shader: sphereShader},
+					{Mesh: blockMesh, Colour: blockColour, Texture: blockTexture, Material: blockMaterial, Shader: blockShader},
+					{Mesh: portalMesh, Colour: portalColour, Texture: portalTexture, Material: portalMaterial, Shader: portalShader},
+				}
+				CheckColours(outline, roles, counts, styles)
+				if assetsPath != "" {
+					CheckAssets(assetsPath, outline, roles, counts, styles)
+				}
+				checkpoint := LoadCheckpoint(checkpointPath, resume)
 				max := 0
-				x := 0
-				for iteration := 0; iteration <= 1000000000; iteration++ {
-					if iteration == (x * x * x * x) {
-						log.Println(x, "^ 4 =", iteration)
-						x++
-					}
-					perspectiveeditorgo.Generate(puzzle, uint32(size), goalCount, goalMesh, goalColour, goalTexture, goalMaterial, goalShader, sphereCount, sphereMesh, sphereColour, sphereTexture, sphereMaterial, sphereShader, blockCount, blockMesh, blockColour, blockTexture, blockMaterial, blockShader, portalCount, portalMesh, portalColour, portalTexture, portalMaterial, portalShader)
-					r, p := perspectiveeditorgo.Score(puzzle, uint32(size))
-					puzzle.Target = uint32(r)
+				for r := range checkpoint.Best {
 					if r > max {
 						max = r
-						log.Println("Score:", r, "/", score)
-						log.Println("Penalties:", p)
-						log.Println("Iteration:", iteration)
-						log.Println("Elapsed:", time.Since(start))
-						log.Println("Puzzle:", puzzle)
-						if r > score {
-							writer := os.Stdout
-							if len(os.Args) > 34 {
-								log.Println("Writing:", os.Args[34])
-								file, err := os.OpenFile(os.Args[34], os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.ModePerm)
-								if err != nil {
-									log.Fatal(err)
-								}
-								defer file.Close()
-								writer = file
-							}
-							if err := perspectivego.WritePuzzle(writer, puzzle); err != nil {
-								log.Fatal(err)
-							}
-							break
-						}
 					}
 				}
+				output := ""
+				if len(os.Args) > 34 {
+					output = os.Args[34]
+				}
+				search := perspectiveeditorgo.NewSearch(budget, checkpoint)
+				search.CheckpointPath = checkpointPath
+				search.Progress = OpenProgress(progressMode, progressInterval, progressOutput, search.Start(), checkpoint.Iteration)
+				search.Interrupt = NotifyInterrupt()
+				search.Generate = func(seed int64) *perspectivego.Puzzle {
+					return perspectiveeditorgo.GenerateVolume(seed, topology, puzzle, volume, goalCount, goalMesh, goalColour, goalTexture, goalMaterial, goalShader, sphereCount, sphereMesh, sphereColour, sphereTexture, sphereMaterial, sphereShader, blockCount, blockMesh, blockColour, blockTexture, blockMaterial, blockShader, portalCount, portalMesh, portalColour, portalTexture, portalMaterial, portalShader)
+				}
+				search.Score = func(puzzle *perspectivego.Puzzle) (int, int) {
+					return scorer(puzzle, volume)
+				}
+				var best *perspectivego.Puzzle
+				search.Accept = func(iteration int, puzzle *perspectivego.Puzzle, r, p int) (bool, error) {
+					puzzle.Target = uint32(r)
+					if r <= max {
+						return false, nil
+					}
+					max = r
+					best = proto.Clone(puzzle).(*perspectivego.Puzzle)
+					checkpoint.Best[r] = p
+					log.Println("Score:", r, "/", score)
+					log.Println("Penalties:", p)
+					log.Println("Iteration:", iteration)
+					log.Println("Elapsed:", time.Since(search.Start()))
+					log.Println("Puzzle:", puzzle)
+					if r > score {
+						WritePuzzleOutput(output, puzzle)
+						return true, perspectiveeditorgo.ErrSearchComplete
+					}
+					return true, nil
+				}
+				reason, err := search.Run()
+				if err != nil {
+					log.Fatal(err)
+				}
+				if reason != perspectiveeditorgo.STOP_COMPLETE && best != nil {
+					// Flush the best candidate found so far, even though it did not reach the score
+					WritePuzzleOutput(output, best)
+				}
+				if err := search.Progress.Report(); err != nil {
+					log.Fatal(err)
+				}
+				PrintSummary(reason, checkpoint, search.Start())
 			} else {
-				log.Println("generate-puzzle <size> <score> <description> <outline-mesh> <outline-colour> <outline-texture> <outline-material> <outline-shader> <goal-count> <goal-mesh...> <goal-colour...> <goal-texture...> <goal-material...> <goal-shader> <sphere-count> <sphere-mesh...> <sphere-colour...> <sphere-texture...> <sphere-material...> <sphere-shader> <block-count> <block-mesh...> <block-colour...> <block-texture...> <block-material...> <block-shader> <portal-count> <portal-mesh...> <portal-colour...> <portal-texture...> <portal-material...> <portal-shader>")
+				log.Println("generate-puzzle [--assets <directory|manifest>] [--checkpoint <file> [--resume]] [--portal-group <count>] [--portal-one-way] [--portal-reorient <probability>] [--scorer <gravity|quarter-turn>] [--bounds <legacy|fall|wall|wrap>] [--progress <terminal|json>] [--progress-interval <duration>] [--progress-output <file>] [--max-iterations <count>] [--max-duration <duration>] [--max-accepted <count>] [--max-stale <count>] <size|<width>x<height>x<depth>> <score> <description> <outline-mesh> <outline-colour> <outline-texture> <outline-material> <outline-shader> <goal-count> <goal-mesh...> <goal-colour...> <goal-texture...> <goal-material...> <goal-shader> <sphere-count> <sphere-mesh...> <sphere-colour...> <sphere-texture...> <sphere-material...> <sphere-shader> <block-count> <block-mesh...> <block-colour...> <block-texture...> <block-material...> <block-shader> <portal-count> <portal-mesh...> <portal-colour...> <portal-texture...> <portal-material...> <portal-shader>")
 			}
-		case "generate-world":
-			if len(os.Args) > 32 {
-				size, err := strconv.Atoi(os.Args[2])
+		case "generate-retrograde":
+			var model, seed, portals, attempts, assetsPath string
+			os.Args, assetsPath = ExtractOption(os.Args, "--assets")
+			os.Args, model = ExtractOption(os.Args, "--bounds")
+			os.Args, seed = ExtractOption(os.Args, "--seed")
+			os.Args, portals = ExtractOption(os.Args, "--portals")
+			os.Args, attempts = ExtractOption(os.Args, "--attempts")
+			if len(os.Args) > 29 {
+				volume := ParseVolume(os.Args[2])
+				bounds, err := volume.Bounds(model)
 				if err != nil {
 					log.Fatal(err)
 				}
-				if size < 0 {
-					log.Fatal("World size must be postive")
+				retrograde := &perspectiveeditorgo.Retrograde{
+					Rotations: ParseCount("Rotations", os.Args[3]),
 				}
-				if size%2 == 0 {
-					log.Fatal("World size must be odd")
+				if portals != "" {
+					retrograde.Portals = ParseCount("Portals", portals)
 				}
+				if attempts != "" {
+					retrograde.Attempts = ParseCount("Attempts", attempts)
+				}
+				s := ParseSeed(seed)
+				puzzle, outline := ParseOutline(os.Args[4:10])
+				styles := ParseStyles(os.Args[10:30])
+				retrograde.Goal = styles[0]
+				retrograde.Sphere = styles[1]
+				retrograde.Block = styles[2]
+				retrograde.Portal = styles[3]
+				roles := []string{"Goal", "Sphere", "Block", "Portal"}
+				counts := []int{1, 1, 1, retrograde.Portals}
+				CheckColours(outline, roles, counts, styles)
+				if assetsPath != "" {
+					CheckAssets(assetsPath, outline, roles, counts, styles)
+				}
+				log.Println("Seed:", s)
+				puzzle, rolls, err := perspectiveeditorgo.GenerateRetrograde(s, puzzle, volume, bounds, retrograde)
+				if err != nil {
+					log.Fatal(err)
+				}
+				PrintRolls(rolls)
+				log.Println("Score:", puzzle.Target)
+				output := ""
+				if len(os.Args) > 30 {
+					output = os.Args[30]
+				}
+				WritePuzzleOutput(output, puzzle)
+			} else {
+				log.Println("generate-retrograde [--assets <directory|manifest>] [--bounds <legacy|fall|wall|wrap>] [--seed <seed>] [--portals <count>] [--attempts <count>] <size|<width>x<height>x<depth>> <rotations> <description> <outline-mesh> <outline-colour> <outline-texture> <outline-material> <outline-shader> <goal-mesh...> <goal-colour...> <goal-texture...> <goal-material...> <goal-shader> <sphere-mesh...> <sphere-colour...> <sphere-texture...> <sphere-material...> <sphere-shader> <block-mesh...> <block-colour...> <block-texture...> <block-material...> <block-shader> <portal-mesh...> <portal-colour...> <portal-texture...> <portal-material...> <portal-shader> [output]")
+			}
+		case "generate-sketch":
+			var model, seed, decoys, attempts, assetsPath string
+			os.Args, assetsPath = ExtractOption(os.Args, "--assets")
+			os.Args, model = ExtractOption(os.Args, "--bounds")
+			os.Args, seed = ExtractOption(os.Args, "--seed")
+			os.Args, decoys = ExtractOption(os.Args, "--decoys")
+			os.Args, attempts = ExtractOption(os.Args, "--attempts")
+			if len(os.Args) > 29 {
+				volume := ParseVolume(os.Args[2])
+				bounds, err := volume.Bounds(model)
+				if err != nil {
+					log.Fatal(err)
+				}
+				sketch, err := perspectiveeditorgo.ParseSketch(os.Args[3])
+				if err != nil {
+					log.Fatal(err)
+				}
+				if decoys != "" {
+					sketch.Decoys = ParseCount("Decoys", decoys)
+				}
+				if attempts != "" {
+					sketch.Attempts = ParseCount("Attempts", attempts)
+				}
+				s := ParseSeed(seed)
+				puzzle, outline := ParseOutline(os.Args[4:10])
+				styles := ParseStyles(os.Args[10:30])
+				sketch.Goal = styles[0]
+				sketch.Sphere = styles[1]
+				sketch.Block = styles[2]
+				sketch.Portal = styles[3]
+				roles := []string{"Goal", "Sphere", "Block", "Portal"}
+				counts := []int{1, 1, 1, sketch.Portals()}
+				CheckColours(outline, roles, counts, styles)
+				if assetsPath != "" {
+					CheckAssets(assetsPath, outline, roles, counts, styles)
+				}
+				log.Println("Seed:", s)
+				puzzle, rolls, err := perspectiveeditorgo.GenerateSketch(s, puzzle, volume, bounds, sketch)
+				if err != nil {
+					log.Fatal(err)
+				}
+				PrintRolls(rolls)
+				log.Println("Score:", puzzle.Target)
+				output := ""
+				if len(os.Args) > 30 {
+					output = os.Args[30]
+				}
+				WritePuzzleOutput(output, puzzle)
+			} else {
+				log.Println("generate-sketch [--assets <directory|manifest>] [--bounds <legacy|fall|wall|wrap>] [--seed <seed>] [--decoys <count>] [--attempts <count>] <size|<width>x<height>x<depth>> <sketch> <description> <outline-mesh> <outline-colour> <outline-texture> <outline-material> <outline-shader> <goal-mesh...> <goal-colour...> <goal-texture...> <goal-material...> <goal-shader> <sphere-mesh...> <sphere-colour...> <sphere-texture...> <sphere-material...> <sphere-shader> <block-mesh...> <block-colour...> <block-texture...> <block-material...> <block-shader> <portal-mesh...> <portal-colour...> <portal-texture...> <portal-material...> <portal-shader> [output]")
+			}
+		case "generate-world":
+			var checkpointPath, progressMode, progressInterval, progressOutput, poolPath, poolSize, assetsPath string
+			var resume bool
+			os.Args, assetsPath = ExtractOption(os.Args, "--assets")
+			os.Args, checkpointPath = ExtractOption(os.Args, "--checkpoint")
+			os.Args, resume = ExtractFlag(os.Args, "--resume")
+			os.Args, progressMode = ExtractOption(os.Args, "--progress")
+			os.Args, progressInterval = ExtractOption(os.Args, "--progress-interval")
+			os.Args, progressOutput = ExtractOption(os.Args, "--progress-output")
+			os.Args, poolPath = ExtractOption(os.Args, "--pool")
+			os.Args, poolSize = ExtractOption(os.Args, "--pool-size")
+			budget := ExtractBudget()
+			topology := ExtractTopology()
+			scorer, _, _ := ExtractScorer()
+			if len(os.Args) > 32 {
+				volume := ParseVolume(os.Args[2])
 				description := os.Args[3]
 				outlineMesh := os.Args[4]
 				outlineColour := os.Args[5]
@@ -311,8 +751,11 @@ func main() {
 				if err != nil {
 					log.Fatal("Portal count error:", err)
 				}
-				if portalCount%2 != 0 {
-					log.Fatal("Portal count must be even")
+				if err := topology.Validate(portalCount); err != nil {
+					log.Fatal(err)
+				}
+				if goalCount+sphereCount+blockCount+portalCount > volume.Cells() {
+					log.Fatal("Element count exceeds the " + volume.String() + " volume")
 				}
 				portalMesh := strings.Split(os.Args[28], ",")
 				portalColour := strings.Split(os.Args[29], ",")
@@ -337,8 +780,21 @@ func main() {
 				if outline != nil {
 					puzzle.Outline = outline
 				}
-				penalties := make(map[int]int)
-				if len(os.Args) > 33 {
+				roles := []string{"Goal", "Sphere", "Block", "Portal"}
+				counts := []int{goalCount, sphereCount, blockCount, portalCount}
+				styles := []*perspectiveeditorgo.ElementStyle{
+					{Mesh: goalMesh, Colour: goalColour, Texture: goalTexture, Material: goalMaterial, Shader: goalShader},
+					{Mesh: sphereMesh, Colour: sphereColour, Texture: sphereTexture, Material: sphereMaterial, Shader: sphereShader},
+					{Mesh: blockMesh, Colour: blockColour, Texture: blockTexture, Material: blockMaterial, Shader: blockShader},
+					{Mesh: portalMesh, Colour: portalColour, Texture: portalTexture, Material: portalMaterial, Shader: portalShader},
+				}
+				CheckColours(outline, roles, counts, styles)
+				if assetsPath != "" {
+					CheckAssets(assetsPath, outline, roles, counts, styles)
+				}
+				checkpoint := LoadCheckpoint(checkpointPath, resume)
+				penalties := checkpoint.Best
+				if len(os.Args) > 33 && !resume {
 					files, err := ioutil.ReadDir(os.Args[33])
 					if err != nil {
 						log.Fatal(err)
@@ -356,95 +812,441 @@ func main() {
 						if err != nil {
 							log.Fatal(err)
 						}
-						r, p := perspectiveeditorgo.Score(puzzle, uint32(size))
+						r, p := scorer(puzzle, volume)
 						penalties[r] = p
 						log.Println("Score:", r)
 						log.Println("Penalties:", p)
 					}
 				}
-				start := time.Now()
-				x := 0
-				for iteration := 0; iteration <= 1000000000; iteration++ {
-					if iteration == (x * x * x * x) {
-						log.Println(x, "^ 4 =", iteration)
-						x++
+				output := ""
+				if len(os.Args) > 33 {
+					output = os.Args[33]
+				}
+				search := perspectiveeditorgo.NewSearch(budget, checkpoint)
+				search.CheckpointPath = checkpointPath
+				search.Progress = OpenProgress(progressMode, progressInterval, progressOutput, search.Start(), checkpoint.Iteration)
+				search.Interrupt = NotifyInterrupt()
+				search.Generate = func(seed int64) *perspectivego.Puzzle {
+					return perspectiveeditorgo.GenerateVolume(seed, topology, puzzle, volume, goalCount, goalMesh, goalColour, goalTexture, goalMaterial, goalShader, sphereCount, sphereMesh, sphereColour, sphereTexture, sphereMaterial, sphereShader, blockCount, blockMesh, blockColour, blockTexture, blockMaterial, blockShader, portalCount, portalMesh, portalColour, portalTexture, portalMaterial, portalShader)
+				}
+				search.Score = func(puzzle *perspectivego.Puzzle) (int, int) {
+					return scorer(puzzle, volume)
+				}
+				var candidates *perspectiveeditorgo.Pool
+				if poolPath != "" {
+					max := perspectiveeditorgo.DEFAULT_POOL_SIZE
+					if poolSize != "" {
+						max = ParseCount("Pool size", poolSize)
+					}
+					if err := os.MkdirAll(poolPath, os.ModePerm); err != nil {
+						log.Fatal(err)
+					}
+					c, dropped, err := perspectiveeditorgo.ReadPool(poolPath, search.Score, max)
+					if err != nil {
+						log.Fatal(err)
+					}
+					RemoveCandidates(poolPath, dropped)
+					candidates = c
+				}
+				best := make(map[int]*perspectivego.Puzzle)
+				search.Accept = func(iteration int, puzzle *perspectivego.Puzzle, r, p int) (bool, error) {
+					if r <= 0 {
+						return false, nil
 					}
-					perspectiveeditorgo.Generate(puzzle, uint32(size), goalCount, goalMesh, goalColour, goalTexture, goalMaterial, goalShader, sphereCount, sphereMesh, sphereColour, sphereTexture, sphereMaterial, sphereShader, blockCount, blockMesh, blockColour, blockTexture, blockMaterial, blockShader, portalCount, portalMesh, portalColour, portalTexture, portalMaterial, portalShader)
-					r, p := perspectiveeditorgo.Score(puzzle, uint32(size))
-					if r > 0 {
-						puzzle.Target = uint32(r)
-						penalty, ok := penalties[r]
-						if !ok || p < penalty {
-							penalties[r] = p
-							log.Println("Score:", r)
-							log.Println("Penalties:", p)
-							log.Println("Iteration:", iteration)
-							log.Println("Elapsed:", time.Since(start))
-							log.Println("Puzzle:", puzzle)
-							writer := os.Stdout
-							if len(os.Args) > 33 {
-								filename := path.Join(os.Args[33], "/puzzle"+strconv.Itoa(r)+".txt")
-								log.Println("Writing:", filename)
-								file, err := os.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.ModePerm)
-								if err != nil {
-									log.Fatal(err)
-								}
-								defer file.Close()
-								writer = file
-							}
-							if err := perspectivego.WritePuzzle(writer, puzzle); err != nil {
-								log.Fatal(err)
-							}
-						}
+					puzzle.Target = uint32(r)
+					pooled := false
+					if candidates != nil {
+						pooled = AddCandidate(poolPath, candidates, puzzle, r, p, checkpoint.IterationSeed(iteration))
 					}
+					penalty, ok := penalties[r]
+					if ok && p >= penalty {
+						return pooled, nil
+					}
+					penalties[r] = p
+					log.Println("Score:", r)
+					log.Println("Penalties:", p)
+					log.Println("Iteration:", iteration)
+					log.Println("Elapsed:", time.Since(search.Start()))
+					log.Println("Puzzle:", puzzle)
+					best[r] = proto.Clone(puzzle).(*perspectivego.Puzzle)
+					if output == "" {
+						WritePuzzleOutput("", puzzle)
+					} else {
+						WritePuzzleOutput(path.Join(output, "/puzzle"+strconv.Itoa(r)+".txt"), puzzle)
+					}
+					return true, nil
 				}
-			} else {
-				log.Println("generate-world <size> <description> <outline-mesh> <outline-colour> <outline-texture> <outline-material> <outline-shader> <goal-count> <goal-mesh...> <goal-colour...> <goal-texture...> <goal-material...> <goal-shader> <sphere-count> <sphere-mesh...> <sphere-colour...> <sphere-texture...> <sphere-material...> <sphere-shader> <block-count> <block-mesh...> <block-colour...> <block-texture...> <block-material...> <block-shader> <portal-count> <portal-mesh...> <portal-colour...> <portal-texture...> <portal-material...> <portal-shader>")
-			}
-		case "score-puzzle":
-			if len(os.Args) > 3 {
-				size, err := strconv.Atoi(os.Args[2])
+				reason, err := search.Run()
 				if err != nil {
 					log.Fatal(err)
 				}
-				if size < 0 {
-					log.Fatal("World size must be postive")
+				if reason == perspectiveeditorgo.STOP_INTERRUPTED && output == "" {
+					// Each improvement is written as soon as it is found, so only flush the pool when it has nowhere else to go
+					for _, r := range SortedScores(best) {
+						WritePuzzleOutput("", best[r])
+					}
 				}
-				if size%2 == 0 {
-					log.Fatal("World size must be odd")
+				if err := search.Progress.Report(); err != nil {
+					log.Fatal(err)
 				}
-				file, err := os.Open(os.Args[3])
+				PrintSummary(reason, checkpoint, search.Start())
+			} else {
+				log.Println("generate-world [--assets <directory|manifest>] [--checkpoint <file> [--resume]] [--portal-group <count>] [--portal-one-way] [--portal-reorient <probability>] [--scorer <gravity|quarter-turn>] [--bounds <legacy|fall|wall|wrap>] [--pool <directory> [--pool-size <count>]] [--progress <terminal|json>] [--progress-interval <duration>] [--progress-output <file>] [--max-iterations <count>] [--max-duration <duration>] [--max-accepted <count>] [--max-stale <count>] <size|<width>x<height>x<depth>> <description> <outline-mesh> <outline-colour> <outline-texture> <outline-material> <outline-shader> <goal-count> <goal-mesh...> <goal-colour...> <goal-texture...> <goal-material...> <goal-shader> <sphere-count> <sphere-mesh...> <sphere-colour...> <sphere-texture...> <sphere-material...> <sphere-shader> <block-count> <block-mesh...> <block-colour...> <block-texture...> <block-material...> <block-shader> <portal-count> <portal-mesh...> <portal-colour...> <portal-texture...> <portal-material...> <portal-shader>")
+			}
+		case "import-vox":
+			if len(os.Args) > 27 {
+				size := ParseSize(os.Args[2])
+				file, err := os.Open(os.Args[3])
 				if err != nil {
 					log.Fatal(err)
 				}
 				defer file.Close()
-				puzzle, err := perspectivego.ReadPuzzle(file)
+				model, err := perspectiveeditorgo.ReadVox(file)
 				if err != nil {
 					log.Fatal(err)
 				}
-				r, p := perspectiveeditorgo.Score(puzzle, uint32(size))
+				roles := make([]*perspectiveeditorgo.VoxRole, 4)
+				for i, name := range []string{"Goal", "Sphere", "Block", "Portal"} {
+					args := os.Args[4+i*6 : 10+i*6]
+					var indices []uint8
+					if args[0] != "" {
+						for _, s := range strings.Split(args[0], ",") {
+							index, err := strconv.ParseUint(s, 10, 8)
+							if err != nil {
+								log.Fatal(name+" palette error:", err)
+							}
+							indices = append(indices, uint8(index))
+						}
+					}
+					roles[i] = &perspectiveeditorgo.VoxRole{
+						ElementStyle: perspectiveeditorgo.ElementStyle{
+							Mesh:     strings.Split(args[1], ","),
+							Colour:   strings.Split(args[2], ","),
+							Texture:  strings.Split(args[3], ","),
+							Material: strings.Split(args[4], ","),
+							Shader:   args[5],
+						},
+						Indices: indices,
+					}
+				}
+				puzzle, err := perspectiveeditorgo.ImportVox(model, uint32(size), roles[0], roles[1], roles[2], roles[3])
+				if err != nil {
+					log.Fatal(err)
+				}
+				if len(puzzle.Sphere) > 0 {
+					r, p := perspectiveeditorgo.Score(puzzle, uint32(size))
+					log.Println("Score:", r)
+					log.Println("Penalties:", p)
+					if r > 0 {
+						puzzle.Target = uint32(r)
+					}
+				}
+				output := ""
+				if len(os.Args) > 28 {
+					output = os.Args[28]
+				}
+				WritePuzzleOutput(output, puzzle)
+			} else {
+				log.Println("import-vox <size> <vox> <goal-palette...> <goal-mesh...> <goal-colour...> <goal-texture...> <goal-material...> <goal-shader> <sphere-palette...> <sphere-mesh...> <sphere-colour...> <sphere-texture...> <sphere-material...> <sphere-shader> <block-palette...> <block-mesh...> <block-colour...> <block-texture...> <block-material...> <block-shader> <portal-palette...> <portal-mesh...> <portal-colour...> <portal-texture...> <portal-material...> <portal-shader> (write to stdout)")
+				log.Println("import-vox <size> <vox> ... <portal-shader> <output>")
+			}
+		case "export-puzzle":
+			if len(os.Args) > 4 {
+				size := ParseSize(os.Args[2])
+				puzzle, err := perspectiveeditorgo.ReadPuzzleFile(os.Args[3])
+				if err != nil {
+					log.Fatal(err)
+				}
+				output := os.Args[4]
+				log.Println("Writing:", output)
+				file, err := os.OpenFile(output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.ModePerm)
+				if err != nil {
+					log.Fatal(err)
+				}
+				defer file.Close()
+				switch path.Ext(output) {
+				case ".gltf":
+					err = perspectiveeditorgo.WritePuzzleGLTF(file, puzzle, uint32(size))
+				case ".obj":
+					materials := strings.TrimSuffix(output, ".obj") + ".mtl"
+					log.Println("Writing:", materials)
+					mtl, err := os.OpenFile(materials, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.ModePerm)
+					if err != nil {
+						log.Fatal(err)
+					}
+					defer mtl.Close()
+					err = perspectiveeditorgo.WritePuzzleOBJ(file, mtl, path.Base(materials), puzzle, uint32(size))
+				default:
+					log.Fatal("Unrecognized format: " + output)
+				}
+				if err != nil {
+					log.Fatal(err)
+				}
+			} else {
+				log.Println("export-puzzle <size> <puzzle> <output.gltf>")
+				log.Println("export-puzzle <size> <puzzle> <output.obj> (materials written to output.mtl)")
+			}
+		case "import-slices":
+			if len(os.Args) > 2 {
+				file, err := os.Open(os.Args[2])
+				if err != nil {
+					log.Fatal(err)
+				}
+				defer file.Close()
+				puzzle, size, err := perspectiveeditorgo.ReadSlices(file, nil)
+				if err != nil {
+					log.Fatal(err)
+				}
+				if len(puzzle.Sphere) > 0 {
+					r, p := perspectiveeditorgo.Score(puzzle, size)
+					log.Println("Score:", r)
+					log.Println("Penalties:", p)
+					if puzzle.Target == 0 && r > 0 {
+						puzzle.Target = uint32(r)
+					}
+				}
+				output := ""
+				if len(os.Args) > 3 {
+					output = os.Args[3]
+				}
+				WritePuzzleOutput(output, puzzle)
+			} else {
+				log.Println("import-slices <slices> (write to stdout)")
+				log.Println("import-slices <slices> <output>")
+			}
+		case "export-slices":
+			if len(os.Args) > 3 {
+				size := ParseSize(os.Args[2])
+				puzzle, err := perspectiveeditorgo.ReadPuzzleFile(os.Args[3])
+				if err != nil {
+					log.Fatal(err)
+				}
+				writer := os.Stdout
+				if len(os.Args) > 4 {
+					log.Println("Writing:", os.Args[4])
+					file, err := os.OpenFile(os.Args[4], os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.ModePerm)
+					if err != nil {
+						log.Fatal(err)
+					}
+					defer file.Close()
+					writer = file
+				}
+				if err := perspectiveeditorgo.WriteSlices(writer, puzzle, uint32(size)); err != nil {
+					log.Fatal(err)
+				}
+			} else {
+				log.Println("export-slices <size> <puzzle> (write to stdout)")
+				log.Println("export-slices <size> <puzzle> <output>")
+			}
+		case "verify-solution":
+			var model string
+			os.Args, model = ExtractOption(os.Args, "--bounds")
+			if len(os.Args) > 4 {
+				size := ParseSize(os.Args[2])
+				bounds, err := perspectiveeditorgo.NewBounds(model, uint32(size))
+				if err != nil {
+					log.Fatal(err)
+				}
+				puzzle, err := perspectiveeditorgo.ReadPuzzleFile(os.Args[3])
+				if err != nil {
+					log.Fatal(err)
+				}
+				list := strings.Join(os.Args[4:], ",")
+				if len(os.Args) == 5 {
+					if data, err := ioutil.ReadFile(os.Args[4]); err == nil {
+						list = string(data)
+					}
+				}
+				moves, err := perspectiveeditorgo.ParseDirections(list)
+				if err != nil {
+					log.Fatal(err)
+				}
+				v := perspectiveeditorgo.VerifySolutionBounds(puzzle, bounds, moves)
+				log.Println("Moves:", len(moves))
+				log.Println("Rotations:", v.Rotations)
+				log.Println("Portals:", strings.Join(v.Portals, ","))
+				log.Println("Location:", perspectivego.LocationToString(v.Location))
+				if !v.Solved {
+					if v.FailedMove >= 0 {
+						log.Println("Failed Move:", v.FailedMove)
+					}
+					log.Fatal("Unsolved: ", v.Failure)
+				}
+				log.Println("Solved")
+			} else {
+				log.Println("verify-solution [--bounds <legacy|fall|wall|wrap>] <size> <puzzle> <direction...> (left, right, down, up, backward or forward, separated by commas or spaces)")
+				log.Println("verify-solution [--bounds <legacy|fall|wall|wrap>] <size> <puzzle> <file>")
+			}
+		case "edit-puzzle":
+			var model string
+			os.Args, model = ExtractOption(os.Args, "--bounds")
+			if len(os.Args) > 3 {
+				volume := ParseVolume(os.Args[2])
+				bounds, err := volume.Bounds(model)
+				if err != nil {
+					log.Fatal(err)
+				}
+				puzzle, err := perspectiveeditorgo.ReadPuzzleFile(os.Args[3])
+				if err != nil {
+					log.Fatal(err)
+				}
+				scorer := perspectiveeditorgo.NewIncrementalScorer(puzzle, bounds)
+				r, p := scorer.Score()
 				log.Println("Score:", r)
 				log.Println("Penalties:", p)
+				scanner := bufio.NewScanner(os.Stdin)
+				for scanner.Scan() {
+					line := strings.TrimSpace(scanner.Text())
+					if line == "" || strings.HasPrefix(line, "#") {
+						continue
+					}
+					if err := scorer.Apply(line); err != nil {
+						log.Println(err)
+						continue
+					}
+					walks := scorer.Walks
+					r, p := scorer.Score()
+					log.Println("Edit:", line)
+					log.Println("Score:", r)
+					log.Println("Penalties:", p)
+					log.Println("Walks:", scorer.Walks-walks)
+				}
+				if err := scanner.Err(); err != nil {
+					log.Fatal(err)
+				}
+				if len(os.Args) > 4 {
+					WritePuzzleOutput(os.Args[4], puzzle)
+				}
 			} else {
-				log.Println("score-puzzle <size> <path>")
+				log.Println("edit-puzzle [--bounds <legacy|fall|wall|wrap>] <size|<width>x<height>x<depth>> <puzzle> [output] (read edits from stdin, one per line: add <element>, remove <name> or move <name> <x,y,z>)")
 			}
-		case "score-world":
+		case "record-replay":
+			var model, seed string
+			os.Args, model = ExtractOption(os.Args, "--bounds")
+			os.Args, seed = ExtractOption(os.Args, "--seed")
 			if len(os.Args) > 3 {
-				size, err := strconv.Atoi(os.Args[2])
+				size := ParseSize(os.Args[2])
+				puzzle, err := perspectiveeditorgo.ReadPuzzleFile(os.Args[3])
 				if err != nil {
 					log.Fatal(err)
 				}
-				if size < 0 {
-					log.Fatal("World size must be postive")
+				replay, err := perspectiveeditorgo.RecordSolver(puzzle, uint32(size), model)
+				if err != nil {
+					log.Fatal(err)
 				}
-				if size%2 == 0 {
-					log.Fatal("World size must be odd")
+				if seed != "" {
+					replay.Seed, err = strconv.ParseInt(seed, 10, 64)
+					if err != nil {
+						log.Fatal(err)
+					}
+					replay.Seeded = true
+				}
+				log.Println("Moves:", len(replay.Moves))
+				if len(os.Args) > 4 {
+					log.Println("Writing:", os.Args[4])
+					if err := perspectiveeditorgo.WriteReplayFile(os.Args[4], replay); err != nil {
+						log.Fatal(err)
+					}
+				} else if err := perspectiveeditorgo.WriteReplay(os.Stdout, replay); err != nil {
+					log.Fatal(err)
+				}
+			} else {
+				log.Println("record-replay [--bounds <legacy|fall|wall|wrap>] [--seed <seed>] <size> <puzzle> (write to stdout)")
+				log.Println("record-replay [--bounds <legacy|fall|wall|wrap>] [--seed <seed>] <size> <puzzle> <output>")
+			}
+		case "play-replay":
+			if len(os.Args) > 3 {
+				puzzle, err := perspectiveeditorgo.ReadPuzzleFile(os.Args[2])
+				if err != nil {
+					log.Fatal(err)
+				}
+				replay, err := perspectiveeditorgo.ReadReplayFile(os.Args[3])
+				if err != nil {
+					log.Fatal(err)
+				}
+				if replay.Model != "" {
+					log.Println("Bounds:", replay.Model)
+				}
+				if replay.Seeded {
+					log.Println("Seed:", replay.Seed)
+				}
+				playback, err := perspectiveeditorgo.NewPlayback(replay, puzzle)
+				if err != nil {
+					log.Fatal(err)
+				}
+				var last *perspectiveeditorgo.ReplayStep
+				for {
+					step, err := playback.Step()
+					if step != nil {
+						log.Println("Move:", step.Index, time.Duration(step.Timestamp)*time.Millisecond, perspectiveeditorgo.DirectionName(step.Direction), "->", perspectivego.LocationToString(step.Location), strings.Join(step.Portals, ","))
+						last = step
+					}
+					if err != nil {
+						log.Fatal(err)
+					}
+					if step == nil {
+						break
+					}
+				}
+				log.Println("Rotations:", playback.Rotations)
+				if last == nil || last.Outcome != perspectiveeditorgo.WALK_GOAL {
+					log.Fatal("Unsolved")
+				}
+				log.Println("Solved")
+			} else {
+				log.Println("play-replay <puzzle> <replay>")
+			}
+		case "score-puzzle":
+			scorer, _, _ := ExtractScorer()
+			if len(os.Args) > 3 {
+				volume := ParseVolume(os.Args[2])
+				file, err := os.Open(os.Args[3])
+				if err != nil {
+					log.Fatal(err)
+				}
+				defer file.Close()
+				puzzle, err := perspectivego.ReadPuzzle(file)
+				if err != nil {
+					log.Fatal(err)
+				}
+				r, p := scorer(puzzle, volume)
+				log.Println("Score:", r)
+				log.Println("Penalties:", p)
+			} else {
+				log.Println("score-puzzle [--scorer <gravity|quarter-turn>] [--bounds <legacy|fall|wall|wrap>] <size|<width>x<height>x<depth>> <path>")
+			}
+		case "score-world":
+			var save bool
+			os.Args, save = ExtractFlag(os.Args, "--save-ratings")
+			scorer, mode, model := ExtractScorer()
+			// Stars count changes of gravity, so they cannot be compared with scores in quarter turns
+			rate := mode == "" || mode == perspectiveeditorgo.SCORER_GRAVITY
+			if save && !rate {
+				log.Fatal("Ratings can only be saved with the " + perspectiveeditorgo.SCORER_GRAVITY + " scorer")
+			}
+			if len(os.Args) > 3 {
+				volume := ParseVolume(os.Args[2])
+				bounds, err := volume.Bounds(model)
+				if err != nil {
+					log.Fatal(err)
 				}
 				files, err := ioutil.ReadDir(os.Args[3])
 				if err != nil {
 					log.Fatal(err)
 				}
 
+				ratingsPath, err := perspectiveeditorgo.RatingsPath(os.Args[3])
+				if err != nil {
+					log.Fatal(err)
+				}
+				stored := make(map[string]*perspectiveeditorgo.Rating)
+				if Exists(ratingsPath) {
+					stored, err = perspectiveeditorgo.ReadRatingsFile(ratingsPath)
+					if err != nil {
+						log.Fatal(err)
+					}
+				}
+				ratings := make(map[string]*perspectiveeditorgo.Rating)
 				for _, file := range files {
 					log.Println("File:", file.Name())
 					f, err := os.Open(path.Join(os.Args[3], file.Name()))
@@ -456,12 +1258,32 @@ func main() {
 					if err != nil {
 						log.Fatal(err)
 					}
-					r, p := perspectiveeditorgo.Score(puzzle, uint32(size))
+					r, p := scorer(puzzle, volume)
 					log.Println("Score:", r)
 					log.Println("Penalties:", p)
+					hash := perspectiveeditorgo.PuzzleHash(puzzle)
+					if s, ok := stored[hash]; ok {
+						log.Println("Stored Stars:", s)
+					}
+					if !rate {
+						continue
+					}
+					rating, err := perspectiveeditorgo.RatePuzzle(puzzle, bounds)
+					if err != nil {
+						log.Println("Stars:", err)
+						continue
+					}
+					log.Println("Stars:", rating)
+					ratings[hash] = rating
+				}
+				if save {
+					log.Println("Writing:", ratingsPath)
+					if err := perspectiveeditorgo.WriteRatingsFile(ratingsPath, ratings); err != nil {
+						log.Fatal(err)
+					}
 				}
 			} else {
-				log.Println("score-world <size> <path>")
+				log.Println("score-world [--save-ratings] [--scorer <gravity|quarter-turn>] [--bounds <legacy|fall|wall|wrap>] <size|<width>x<height>x<depth>> <path>")
 			}
 		case "convert-world":
 			if len(os.Args) > 4 {
@@ -512,6 +1334,66 @@ func main() {
 			} else {
 				log.Println("convert-world <size> <old-path> <new-path>")
 			}
+		case "show-pool":
+			scorer, _, _ := ExtractScorer()
+			if len(os.Args) > 3 {
+				volume := ParseVolume(os.Args[2])
+				pool, dropped, err := perspectiveeditorgo.ReadPool(os.Args[3], func(puzzle *perspectivego.Puzzle) (int, int) {
+					return scorer(puzzle, volume)
+				}, 0)
+				if err != nil {
+					log.Fatal(err)
+				}
+				for _, r := range pool.Scores() {
+					fmt.Println("Score:", r)
+					for _, c := range pool.Candidates[r] {
+						fmt.Println("\t"+c.Name, "Penalty:", c.Metrics.Penalty, "Elements:", c.Metrics.Elements, "Portals:", c.Metrics.Portals, "Extent:", c.Metrics.Extent)
+					}
+				}
+				for _, c := range dropped {
+					fmt.Println("Dominated:", c.Name, "Score:", c.Metrics.Score)
+				}
+			} else {
+				log.Println("show-pool [--scorer <gravity|quarter-turn>] [--bounds <legacy|fall|wall|wrap>] <size|<width>x<height>x<depth>> <pool>")
+			}
+		case "select-pool":
+			scorer, _, _ := ExtractScorer()
+			if len(os.Args) > 5 {
+				path := os.Args[2]
+				world, err := perspectivego.ReadWorldFile(path)
+				if err != nil {
+					log.Fatal(err)
+				}
+				volume := ParseVolume(os.Args[3])
+				pool, _, err := perspectiveeditorgo.ReadPool(os.Args[4], func(puzzle *perspectivego.Puzzle) (int, int) {
+					return scorer(puzzle, volume)
+				}, 0)
+				if err != nil {
+					log.Fatal(err)
+				}
+				for _, name := range os.Args[5:] {
+					var candidate *perspectiveeditorgo.Candidate
+					if r, err := strconv.Atoi(name); err == nil {
+						candidate = pool.Best(r)
+					} else {
+						candidate = pool.Get(name)
+					}
+					if candidate == nil {
+						log.Fatal("Could not find candidate:", name)
+					}
+					if err := perspectiveeditorgo.CheckGamePuzzle(candidate.Puzzle); err != nil {
+						log.Fatal(candidate.Name+": ", err)
+					}
+					log.Println("Adding:", candidate.Name)
+					candidate.Puzzle.Target = uint32(candidate.Metrics.Score)
+					world.Puzzle = append(world.Puzzle, candidate.Puzzle)
+				}
+				if err := perspectivego.WriteWorldFile(path, world); err != nil {
+					log.Fatal(err)
+				}
+			} else {
+				log.Println("select-pool [--scorer <gravity|quarter-turn>] [--bounds <legacy|fall|wall|wrap>] <world> <size|<width>x<height>x<depth>> <pool> <candidate...> (a candidate is either a file name or a score for the best candidate with that score)")
+			}
 		default:
 			log.Println("Cannot handle", os.Args[1])
 		}
@@ -532,18 +1414,425 @@ func Exists(filename string) bool {
 	return true
 }
 
+// ExtractFlag removes all occurrences of the given flag from args and reports whether it was present.
+func ExtractFlag(args []string, name string) ([]string, bool) {
+	found := false
+	result := make([]string, 0, len(args))
+	for _, a := range args {
+		if a == name {
+			found = true
+		} else {
+			result = append(result, a)
+		}
+	}
+	return result, found
+}
+
+// ExtractOption removes the given option and its value from args and returns the value, or an empty string if absent.
+func ExtractOption(args []string, name string) ([]string, string) {
+	value := ""
+	result := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		if args[i] == name {
+			if i+1 >= len(args) {
+				log.Fatal("Missing value for ", name)
+			}
+			i++
+			value = args[i]
+		} else {
+			result = append(result, args[i])
+		}
+	}
+	return result, value
+}
+
+func LoadCheckpoint(path string, resume bool) *perspectiveeditorgo.Checkpoint {
+	if !resume {
+		return perspectiveeditorgo.NewCheckpoint(time.Now().UnixNano())
+	}
+	if path == "" {
+		log.Fatal("Resume requires --checkpoint")
+	}
+	checkpoint, err := perspectiveeditorgo.ReadCheckpointFile(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Println("Resuming:", path)
+	log.Println("Seed:", checkpoint.Seed)
+	log.Println("Iteration:", checkpoint.Iteration)
+	log.Println("Elapsed:", checkpoint.Elapsed)
+	return checkpoint
+}
+
+// OpenProgress creates a progress reporter, defaulting to a terminal display on stderr every 10 seconds.
+func OpenProgress(mode, interval, output string, start time.Time, iteration int) *perspectiveeditorgo.Progress {
+	if mode == "" {
+		mode = perspectiveeditorgo.PROGRESS_TERMINAL
+	}
+	duration := 10 * time.Second
+	if interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			log.Fatal(err)
+		}
+		duration = d
+	}
+	var writer io.Writer = os.Stderr
+	if output != "" {
+		file, err := os.OpenFile(output, os.O_CREATE|os.O_APPEND|os.O_WRONLY, os.ModePerm)
+		if err != nil {
+			log.Fatal(err)
+		}
+		writer = file
+	}
+	w, err := perspectiveeditorgo.NewProgressWriter(mode, writer)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return perspectiveeditorgo.NewProgress(w, duration, start, iteration, perspectiveeditorgo.DEFAULT_MAX_ITERATIONS)
+}
+
+// ExtractBudget removes the budget options from os.Args and returns the resulting budget.
+func ExtractBudget() *perspectiveeditorgo.Budget {
+	var iterations, duration, accepted, stale string
+	os.Args, iterations = ExtractOption(os.Args, "--max-iterations")
+	os.Args, duration = ExtractOption(os.Args, "--max-duration")
+	os.Args, accepted = ExtractOption(os.Args, "--max-accepted")
+	os.Args, stale = ExtractOption(os.Args, "--max-stale")
+	budget := perspectiveeditorgo.DefaultBudget()
+	if iterations != "" {
+		budget.MaxIterations = ParseCount("Max iterations", iterations)
+	}
+	if duration != "" {
+		d, err := time.ParseDuration(duration)
+		if err != nil {
+			log.Fatal("Max duration error:", err)
+		}
+		budget.MaxDuration = d
+	}
+	if accepted != "" {
+		budget.MaxAccepted = ParseCount("Max accepted", accepted)
+	}
+	if stale != "" {
+		budget.MaxStale = ParseCount("Max stale", stale)
+	}
+	return budget
+}
+
+// ExtractTopology removes the portal options from the arguments and returns the portal topology they describe.
+func ExtractTopology() *perspectiveeditorgo.PortalTopology {
+	var group, reorient string
+	topology := perspectiveeditorgo.DefaultPortalTopology()
+	os.Args, group = ExtractOption(os.Args, "--portal-group")
+	os.Args, topology.OneWay = ExtractFlag(os.Args, "--portal-one-way")
+	os.Args, reorient = ExtractOption(os.Args, "--portal-reorient")
+	if group != "" {
+		topology.GroupSize = ParseCount("Portal group", group)
+	}
+	if reorient != "" {
+		r, err := strconv.ParseFloat(reorient, 64)
+		if err != nil {
+			log.Fatal("Portal reorient error:", err)
+		}
+		topology.Reorient = r
+	}
+	return topology
+}
+
+// ExtractScorer removes the scorer and bounds options from the arguments and returns the scoring function they select, along with the options.
+func ExtractScorer() (func(*perspectivego.Puzzle, *perspectiveeditorgo.Volume) (int, int), string, string) {
+	var mode, model string
+	os.Args, mode = ExtractOption(os.Args, "--scorer")
+	os.Args, model = ExtractOption(os.Args, "--bounds")
+	bounds, err := perspectiveeditorgo.NewBounds(model, 1)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := perspectiveeditorgo.NewScorer(mode, bounds); err != nil {
+		log.Fatal(err)
+	}
+	// Scorers are kept for each volume so their state is reused across puzzles
+	scorers := make(map[perspectiveeditorgo.Volume]func(*perspectivego.Puzzle) (int, int))
+	return func(puzzle *perspectivego.Puzzle, volume *perspectiveeditorgo.Volume) (int, int) {
+		scorer, ok := scorers[*volume]
+		if !ok {
+			bounds, _ := volume.Bounds(model)
+			scorer, _ = perspectiveeditorgo.NewScorer(mode, bounds)
+			scorers[*volume] = scorer
+		}
+		return scorer(puzzle)
+	}, mode, model
+}
+
+func ParseCount(name, value string) int {
+	count, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatal(name+" error:", err)
+	}
+	if count < 0 {
+		log.Fatal(name + " must not be negative")
+	}
+	return count
+}
+
+// NotifyInterrupt returns a channel which receives SIGINT and SIGTERM instead of them terminating the process.
+func NotifyInterrupt() chan os.Signal {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	return signals
+}
+
+func WritePuzzleOutput(filename string, puzzle *perspectivego.Puzzle) {
+	if filename == "" {
+		if err := perspectivego.WritePuzzle(os.Stdout, puzzle); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	log.Println("Writing:", filename)
+	if err := perspectivego.WritePuzzleFile(filename, puzzle); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// CheckColours exits if the outline, or any element with a non-zero count, has a colour which cannot be parsed.
+func CheckColours(outline *perspectivego.Outline, names []string, counts []int, styles []*perspectiveeditorgo.ElementStyle) {
+	if outline != nil {
+		if _, err := perspectiveeditorgo.ParseColour(outline.Colour); err != nil {
+			log.Fatal("Outline ", err)
+		}
+	}
+	for i, s := range styles {
+		if counts[i] == 0 {
+			continue
+		}
+		for _, c := range s.Colour {
+			if _, err := perspectiveeditorgo.ParseColour(c); err != nil {
+				log.Fatal(names[i]+" ", err)
+			}
+		}
+	}
+}
+
+// CheckAssets exits if the outline, or the style of any element with a non-zero count, uses an asset which is not in the asset directory or manifest.
+func CheckAssets(path string, outline *perspectivego.Outline, names []string, counts []int, styles []*perspectiveeditorgo.ElementStyle) {
+	assets, err := perspectiveeditorgo.ReadAssets(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if outline != nil {
+		if err := assets.ValidateStyle(&perspectiveeditorgo.ElementStyle{
+			Mesh:     []string{outline.Mesh},
+			Texture:  []string{outline.Texture},
+			Material: []string{outline.Material},
+		}); err != nil {
+			log.Fatal("Outline ", err)
+		}
+	}
+	for i, s := range styles {
+		if counts[i] == 0 {
+			continue
+		}
+		if err := assets.ValidateStyle(s); err != nil {
+			log.Fatal(names[i]+" ", err)
+		}
+	}
+}
+
+// ParseVolume parses a world size, or per-axis dimensions as <width>x<height>x<depth>.
+func ParseVolume(s string) *perspectiveeditorgo.Volume {
+	volume, err := perspectiveeditorgo.ParseVolume(s)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return volume
+}
+
+// ParseSeed parses a seed, defaulting to the current time.
+func ParseSeed(s string) int64 {
+	if s == "" {
+		return time.Now().UnixNano()
+	}
+	seed, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		log.Fatal("Seed error:", err)
+	}
+	return seed
+}
+
+// ParseOutline returns an empty puzzle with the description and outline given by the arguments <description> <outline-mesh> <outline-colour> <outline-texture> <outline-material> <outline-shader>.
+// The outline is nil unless it has both a mesh and a colour.
+func ParseOutline(args []string) (*perspectivego.Puzzle, *perspectivego.Outline) {
+	puzzle := &perspectivego.Puzzle{
+		Description: args[0],
+	}
+	if args[1] == "" || args[2] == "" {
+		return puzzle, nil
+	}
+	puzzle.Outline = &perspectivego.Outline{
+		Mesh:     args[1],
+		Colour:   args[2],
+		Texture:  args[3],
+		Material: args[4],
+		Shader:   args[5],
+	}
+	return puzzle, puzzle.Outline
+}
+
+// ParseStyles parses a style from each five arguments <mesh...> <colour...> <texture...> <material...> <shader>, with lists separated by commas.
+func ParseStyles(args []string) []*perspectiveeditorgo.ElementStyle {
+	var styles []*perspectiveeditorgo.ElementStyle
+	for a := 0; a+4 < len(args); a += 5 {
+		styles = append(styles, &perspectiveeditorgo.ElementStyle{
+			Mesh:     strings.Split(args[a], ","),
+			Colour:   strings.Split(args[a+1], ","),
+			Texture:  strings.Split(args[a+2], ","),
+			Material: strings.Split(args[a+3], ","),
+			Shader:   args[a+4],
+		})
+	}
+	return styles
+}
+
+// PrintRolls logs each roll of a constructed puzzle, with the portals it passes through.
+func PrintRolls(rolls []*perspectiveeditorgo.Roll) {
+	for i, r := range rolls {
+		roll := perspectivego.LocationToString(r.From) + " " + perspectiveeditorgo.DirectionName(r.Direction) + " " + perspectivego.LocationToString(r.To)
+		if r.Entrance != nil {
+			roll += " via " + perspectivego.LocationToString(r.Entrance) + " to " + perspectivego.LocationToString(r.Exit)
+		}
+		log.Println("Roll", i, roll)
+	}
+}
+
+// ParseSize parses a world size, which must be positive and odd.
+func ParseSize(s string) int {
+	size, err := strconv.Atoi(s)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if size < 0 {
+		log.Fatal("World size must be postive")
+	}
+	if size%2 == 0 {
+		log.Fatal("World size must be odd")
+	}
+	return size
+}
+
+// AddCandidate adds the puzzle to the pool and keeps the pool directory in sync, returning whether the puzzle was added.
+func AddCandidate(directory string, pool *perspectiveeditorgo.Pool, puzzle *perspectivego.Puzzle, score, penalty int, seed int64) bool {
+	candidate := &perspectiveeditorgo.Candidate{
+		Name:    perspectiveeditorgo.CandidateName(score, seed),
+		Puzzle:  proto.Clone(puzzle).(*perspectivego.Puzzle),
+		Metrics: perspectiveeditorgo.NewMetrics(puzzle, score, penalty),
+	}
+	added, removed := pool.Add(candidate)
+	if !added {
+		return false
+	}
+	WritePuzzleOutput(path.Join(directory, candidate.Name), candidate.Puzzle)
+	RemoveCandidates(directory, removed)
+	return true
+}
+
+// RemoveCandidates deletes the files of candidates which are no longer in the pool.
+func RemoveCandidates(directory string, candidates []*perspectiveeditorgo.Candidate) {
+	for _, c := range candidates {
+		log.Println("Removing:", c.Name)
+		if err := os.Remove(path.Join(directory, c.Name)); err != nil && !os.IsNotExist(err) {
+			log.Fatal(err)
+		}
+	}
+}
+
+func SortedScores(pool map[int]*perspectivego.Puzzle) []int {
+	scores := make([]int, 0, len(pool))
+	for r := range pool {
+		scores = append(scores, r)
+	}
+	sort.Ints(scores)
+	return scores
+}
+
+func PrintSummary(reason string, checkpoint *perspectiveeditorgo.Checkpoint, start time.Time) {
+	elapsed := time.Since(start)
+	log.Println("Summary")
+	log.Println("Stopped:", reason)
+	log.Println("Seed:", checkpoint.Seed)
+	log.Println("Iterations:", checkpoint.Iteration)
+	log.Println("Accepted:", checkpoint.Accepted)
+	log.Println("Elapsed:", elapsed)
+	if seconds := elapsed.Seconds(); seconds > 0 {
+		log.Println("Rate:", int(float64(checkpoint.Iteration)/seconds), "iterations/second")
+	}
+	scores := make([]int, 0, len(checkpoint.Best))
+	for r := range checkpoint.Best {
+		scores = append(scores, r)
+	}
+	sort.Ints(scores)
+	for _, r := range scores {
+		log.Println("Score:", r, "Penalties:", checkpoint.Best[r])
+	}
+}
+
 func PrintUsage(output io.Writer) {
 	fmt.Fprintln(output, "Perspective Editor Usage:")
 	fmt.Fprintln(output, "\tperspective-editor - display usage")
 	fmt.Fprintln(output, "\tperspective-editor create-world [name] [size] [foreground-colour] [background-colour] - creates a new world with the given name, size and colour scheme")
 	fmt.Fprintln(output, "\tperspective-editor show-world [world] - shows the given world")
+	fmt.Fprintln(output, "\tperspective-editor check-colours [world] - reports colours which cannot be parsed, and goal, block and portal colours too close to the background or each other, including under colour-blindness simulations")
+	fmt.Fprintln(output, "\tperspective-editor apply-theme [world] [theme] - recolours the world by element role with a built-in theme ("+strings.Join(perspectiveeditorgo.ThemeNames(), ", ")+") or a theme file")
+	fmt.Fprintln(output, "\tperspective-editor check-assets [directory|manifest] [world] - reports unknown, unused and per-asset usage of meshes, textures and materials, where a manifest has one mesh:, texture: or material: line per asset and a directory has mesh, texture and material subdirectories")
+	fmt.Fprintln(output, "\tperspective-editor merge-worlds [output] [world...] - combines the puzzles and shaders of the given worlds, skipping duplicate puzzles and failing on conflicting shaders")
+	fmt.Fprintln(output, "\tperspective-editor split-world [--range 0-4,7] [--description text] [--min-target score] [--max-target score] [world] [output] - extracts the matching puzzles, and the shaders they use, into a new world")
+	fmt.Fprintln(output, "\tperspective-editor diff-world [old-world] [new-world] - shows the puzzles, elements, shaders, colours and scores that differ between the worlds")
+	fmt.Fprintln(output, "\tperspective-editor diff-puzzle [size] [old-puzzle] [new-puzzle] - shows the elements and score that differ between the puzzles")
 	fmt.Fprintln(output)
 	fmt.Fprintln(output, "\tperspective-editor add-shader [world] [name] [attributes] [uniforms] [vertex-source-file] [fragment-source-file] - adds a shader with the given name to the world")
 	fmt.Fprintln(output)
-	fmt.Fprintln(output, "\tperspective-editor add-puzzle [world] - adds a puzzle to the world")
-	fmt.Fprintln(output, "\tperspective-editor generate-puzzle [size] [score] [description] [outline-mesh] [outline-colour] [outline-texture] [outline-material] [outline-shader] [goal-count] [goal-mesh...] [goal-colour...] [goal-texture...] [goal-material...] [goal-shader] [sphere-count] [sphere-mesh...] [sphere-colour...] [sphere-texture...] [sphere-material...] [sphere-shader] [block-count] [block-mesh...] [block-colour...] [block-texture...] [block-material...] [block-shader] [portal-count] [portal-mesh...] [portal-colour...] [portal-texture...] [portal-material...] [portal-shader] - generates a new puzzle with the given attributes")
-	fmt.Fprintln(output, "\tperspective-editor generate-world [size] [description] [outline-mesh] [outline-colour] [outline-texture] [outline-material] [outline-shader] [goal-count] [goal-mesh...] [goal-colour...] [goal-texture...] [goal-material...] [goal-shader] [sphere-count] [sphere-mesh...] [sphere-colour...] [sphere-texture...] [sphere-material...] [sphere-shader] [block-count] [block-mesh...] [block-colour...] [block-texture...] [block-material...] [block-shader] [portal-count] [portal-mesh...] [portal-colour...] [portal-texture...] [portal-material...] [portal-shader] - generates a new pool of puzzle with the given attributes")
-	fmt.Fprintln(output, "\tperspective-editor score-puzzle [size] [path] - scores the puzzle under the given path")
-	fmt.Fprintln(output, "\tperspective-editor score-world [size] [path] - scores all puzzles under the given path")
+	fmt.Fprintln(output, "\tperspective-editor unpack-world [world] [directory] - splits the world into a manifest, puzzle files and shader sources in the given directory")
+	fmt.Fprintln(output, "\tperspective-editor pack-world [directory] [world] - rebuilds the world from the given unpacked directory")
+	fmt.Fprintln(output, "\tperspective-editor export-world [--format json|text] [world] [output] - exports the world as json (default) or protobuf text")
+	fmt.Fprintln(output, "\tperspective-editor import-world [world] [file] - creates the world from the given json")
+	fmt.Fprintln(output)
+	fmt.Fprintln(output, "\tperspective-editor add-puzzle [--format text|json|slices] [world] - adds a puzzle to the world, refusing exits and reorienting portals which the game cannot play")
+	fmt.Fprintln(output, "\tperspective-editor generate-puzzle [size|widthxheightxdepth] [score] [description] [outline-mesh] [outline-colour] [outline-texture] [outline-material] [outline-shader] [goal-count] [goal-mesh...] [goal-colour...] [goal-texture...] [goal-material...] [goal-shader] [sphere-count] [sphere-mesh...] [sphere-colour...] [sphere-texture...] [sphere-material...] [sphere-shader] [block-count] [block-mesh...] [block-colour...] [block-texture...] [block-material...] [block-shader] [portal-count] [portal-mesh...] [portal-colour...] [portal-texture...] [portal-material...] [portal-shader] - generates a new puzzle with the given attributes")
+	fmt.Fprintln(output, "\tperspective-editor generate-retrograde [--assets directory|manifest] [--bounds legacy|fall|wall|wrap] [--seed seed] [--portals count] [--attempts count] [size|widthxheightxdepth] [rotations] [description] [outline-mesh] [outline-colour] [outline-texture] [outline-material] [outline-shader] [goal-mesh...] [goal-colour...] [goal-texture...] [goal-material...] [goal-shader] [sphere-mesh...] [sphere-colour...] [sphere-texture...] [sphere-material...] [sphere-shader] [block-mesh...] [block-colour...] [block-texture...] [block-material...] [block-shader] [portal-mesh...] [portal-colour...] [portal-texture...] [portal-material...] [portal-shader] [output] - constructs a puzzle backwards from its goal, placing blocks where the sphere must stop and optionally routing rolls through portals, so the optimal solution needs exactly the given rotations")
+	fmt.Fprintln(output, "\tperspective-editor generate-sketch [--assets directory|manifest] [--bounds legacy|fall|wall|wrap] [--seed seed] [--decoys count] [--attempts count] [size|widthxheightxdepth] [sketch] [description] [outline-mesh] [outline-colour] [outline-texture] [outline-material] [outline-shader] [goal-mesh...] [goal-colour...] [goal-texture...] [goal-material...] [goal-shader] [sphere-mesh...] [sphere-colour...] [sphere-texture...] [sphere-material...] [sphere-shader] [block-mesh...] [block-colour...] [block-texture...] [block-material...] [block-shader] [portal-mesh...] [portal-colour...] [portal-texture...] [portal-material...] [portal-shader] [output] - lays out a puzzle following a sketched route, given as stops \"x,y,z x,y,z ...\" or gravity directions \"down left ...\", placing only the blocks and portals the route needs and then decoy blocks so it is the unique optimal solution")
+	fmt.Fprintln(output, "\tperspective-editor generate-world [size|widthxheightxdepth] [description] [outline-mesh] [outline-colour] [outline-texture] [outline-material] [outline-shader] [goal-count] [goal-mesh...] [goal-colour...] [goal-texture...] [goal-material...] [goal-shader] [sphere-count] [sphere-mesh...] [sphere-colour...] [sphere-texture...] [sphere-material...] [sphere-shader] [block-count] [block-mesh...] [block-colour...] [block-texture...] [block-material...] [block-shader] [portal-count] [portal-mesh...] [portal-colour...] [portal-texture...] [portal-material...] [portal-shader] - generates a new pool of puzzle with the given attributes")
+	fmt.Fprintln(output)
+	fmt.Fprintln(output, "\tGeneration options:")
+	fmt.Fprintln(output, "\t\t--assets [directory|manifest] - refuses meshes, textures and materials which are not in the given assets")
+	fmt.Fprintln(output, "\t\t--checkpoint [file] - periodically saves the state of the run to the given file")
+	fmt.Fprintln(output, "\t\t--resume - continues the run saved in the checkpoint file")
+	fmt.Fprintln(output, "\t\t--progress [terminal|json] - sets the format of progress reports, json writes one object per line")
+	fmt.Fprintln(output, "\t\t--progress-interval [duration] - sets the time between progress reports (default 10s)")
+	fmt.Fprintln(output, "\t\t--progress-output [file] - appends progress reports to the given file instead of stderr")
+	fmt.Fprintln(output, "\t\t--max-iterations [count] - stops after the given number of iterations (default 1000000000)")
+	fmt.Fprintln(output, "\t\t--max-duration [duration] - stops after the given wall-clock time")
+	fmt.Fprintln(output, "\t\t--max-accepted [count] - stops after the given number of puzzles are accepted")
+	fmt.Fprintln(output, "\t\t--max-stale [count] - stops after the given number of iterations without an accepted puzzle")
+	fmt.Fprintln(output, "\t\t--portal-group [count] - links portals in cycles of the given size (default 2, pairs)")
+	fmt.Fprintln(output, "\t\t--portal-one-way - links each portal group as a chain ending in an exit instead of a cycle, which only the editor can score")
+	fmt.Fprintln(output, "\t\t--portal-reorient [probability] - gives each portal the given chance of changing gravity to a random direction, which only the editor can score")
+	fmt.Fprintln(output, "\t\t--scorer [gravity|quarter-turn] - scores with a rotation per change of gravity (default), or per quarter turn of the camera through the 24 cube orientations")
+	fmt.Fprintln(output, "\t\t--bounds [legacy|fall|wall|wrap] - sets what happens at the edge of the world: falling off beyond twice the world size (default), falling off the world, resting against walls at the outline, or wrapping around to the opposite side")
+	fmt.Fprintln(output, "\t\t--pool [directory] - keeps the Pareto front of candidates for each score in the given directory (generate-world only)")
+	fmt.Fprintln(output, "\t\t--pool-size [count] - limits the number of candidates kept for each score (default 10)")
+	fmt.Fprintln(output)
+	fmt.Fprintln(output, "\tperspective-editor show-pool [options] [size] [pool] - shows the candidates in the given pool directory, scored as generate-world scores them")
+	fmt.Fprintln(output, "\tperspective-editor select-pool [options] [world] [size] [pool] [candidate...] - adds the given candidates, by file name or score, from the pool to the world")
+	fmt.Fprintln(output)
+	fmt.Fprintln(output, "\tperspective-editor import-vox [size] [vox] [goal-palette...] [goal-mesh...] [goal-colour...] [goal-texture...] [goal-material...] [goal-shader] [sphere-palette...] [sphere-mesh...] [sphere-colour...] [sphere-texture...] [sphere-material...] [sphere-shader] [block-palette...] [block-mesh...] [block-colour...] [block-texture...] [block-material...] [block-shader] [portal-palette...] [portal-mesh...] [portal-colour...] [portal-texture...] [portal-material...] [portal-shader] - creates a puzzle from a MagicaVoxel model, mapping palette indices to elements (a colour of 'palette' uses the voxel colour)")
+	fmt.Fprintln(output, "\tperspective-editor import-slices [slices] [output] - creates a puzzle from a text file with one grid per Z layer ('#' block, '*' goal, '@' sphere, 'A' linked to 'a' portals)")
+	fmt.Fprintln(output, "\tperspective-editor export-slices [size] [puzzle] [output] - writes the puzzle as a text file with one grid per Z layer")
+	fmt.Fprintln(output, "\tperspective-editor export-puzzle [size] [puzzle] [output] - exports the puzzle for 3D preview as glTF (.gltf) or OBJ and MTL (.obj)")
+	fmt.Fprintln(output, "\tperspective-editor verify-solution [--bounds legacy|fall|wall|wrap] [size] [puzzle] [direction...] - simulates the given gravity directions, the first being the starting gravity, and reports whether the goal was reached, the rotations, the portals traversed and any failure")
+	fmt.Fprintln(output, "\tperspective-editor edit-puzzle [--bounds legacy|fall|wall|wrap] [size|widthxheightxdepth] [puzzle] [output] - applies edits read from stdin (add [element], remove [name] or move [name] [x,y,z]), rescoring incrementally after each, and writes the edited puzzle to the output")
+	fmt.Fprintln(output, "\tperspective-editor record-replay [--bounds legacy|fall|wall|wrap] [--seed seed] [size] [puzzle] [output] - records the solver's optimal path through the puzzle as a replay")
+	fmt.Fprintln(output, "\tperspective-editor play-replay [puzzle] [replay] - plays the replay against the puzzle one move at a time, under the size and bounds it was recorded with")
+	fmt.Fprintln(output, "\tperspective-editor score-puzzle [--scorer gravity|quarter-turn] [--bounds legacy|fall|wall|wrap] [size|widthxheightxdepth] [path] - scores the puzzle under the given path")
+	fmt.Fprintln(output, "\tperspective-editor score-world [--save-ratings] [--scorer gravity|quarter-turn] [--bounds legacy|fall|wall|wrap] [size|widthxheightxdepth] [path] - scores and computes the 3, 2 and 1 star pars of all puzzles under the given path, optionally saving the pars to a file beside the path, named after it with the suffix "+perspectiveeditorgo.RATINGS_SUFFIX+"; stars are only rated with the gravity scorer")
 	fmt.Fprintln(output, "\tperspective-editor convert-world [size] [old-path] [new-path] - converts and retargets all puzzles under the old path to the new path")
 }
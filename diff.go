@@ -0,0 +1,320 @@
+/*
+ * Copyright 2019 Aletheia Ware LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package perspectiveeditorgo
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/AletheiaWareLLC/perspectivego"
+	"sort"
+	"strings"
+)
+
+const (
+	DIFF_ADDED   = "+"
+	DIFF_REMOVED = "-"
+	DIFF_CHANGED = "~"
+	DIFF_MOVED   = ">"
+)
+
+// Difference is a single change between two worlds or puzzles.
+// Path identifies what changed, such as puzzle[2].block[b0].location, and Old and New are empty for added and removed values respectively.
+type Difference struct {
+	Kind string
+	Path string
+	Old  string
+	New  string
+}
+
+func (d *Difference) String() string {
+	switch d.Kind {
+	case DIFF_ADDED:
+		return d.Kind + " " + d.Path + ": " + d.New
+	case DIFF_REMOVED:
+		return d.Kind + " " + d.Path + ": " + d.Old
+	default:
+		return d.Kind + " " + d.Path + ": " + d.Old + " -> " + d.New
+	}
+}
+
+// DiffWorlds compares two worlds.
+// Puzzles with identical canonical content are matched regardless of position and reported if reordered,
+// the remaining puzzles are paired by similarity and compared element by element, and anything left over is added or removed.
+func DiffWorlds(old, new *perspectivego.World) []*Difference {
+	var diffs []*Difference
+	changed := func(path, o, n string) {
+		if o != n {
+			diffs = append(diffs, &Difference{Kind: DIFF_CHANGED, Path: path, Old: o, New: n})
+		}
+	}
+	changed("name", old.Name, new.Name)
+	changed("title", old.Title, new.Title)
+	changed("size", fmt.Sprint(old.Size), fmt.Sprint(new.Size))
+	changed("foreground_colour", old.ForegroundColour, new.ForegroundColour)
+	changed("background_colour", old.BackgroundColour, new.BackgroundColour)
+
+	oldShaders := SortedShaderNames(old)
+	newShaders := SortedShaderNames(new)
+	for _, n := range oldShaders {
+		o := old.Shader[n]
+		s, ok := new.Shader[n]
+		path := "shader[" + n + "]"
+		if !ok {
+			diffs = append(diffs, &Difference{Kind: DIFF_REMOVED, Path: path, Old: n})
+			continue
+		}
+		changed(path+".attributes", strings.Join(o.Attributes, ","), strings.Join(s.Attributes, ","))
+		changed(path+".uniforms", strings.Join(o.Uniforms, ","), strings.Join(s.Uniforms, ","))
+		diffs = append(diffs, DiffLines(path+".vertex_source", o.VertexSource, s.VertexSource)...)
+		diffs = append(diffs, DiffLines(path+".fragment_source", o.FragmentSource, s.FragmentSource)...)
+	}
+	for _, n := range newShaders {
+		if _, ok := old.Shader[n]; !ok {
+			diffs = append(diffs, &Difference{Kind: DIFF_ADDED, Path: "shader[" + n + "]", New: n})
+		}
+	}
+
+	// Match puzzles with identical content
+	matches := make(map[int]int)
+	matched := make(map[int]bool)
+	canonical := make(map[string][]int)
+	for j, p := range new.Puzzle {
+		c := CanonicalPuzzle(p)
+		canonical[c] = append(canonical[c], j)
+	}
+	for i, p := range old.Puzzle {
+		c := CanonicalPuzzle(p)
+		if js := canonical[c]; len(js) > 0 {
+			matches[i] = js[0]
+			matched[js[0]] = true
+			canonical[c] = js[1:]
+		}
+	}
+	// Pair the remaining puzzles by the number of shared elements, preferring the nearest position
+	for i, p := range old.Puzzle {
+		if _, ok := matches[i]; ok {
+			continue
+		}
+		best, bestShared := -1, 0
+		for j, q := range new.Puzzle {
+			if matched[j] {
+				continue
+			}
+			shared := sharedElements(p, q)
+			if p.Description != "" && p.Description == q.Description {
+				shared++
+			}
+			if shared > bestShared || (shared == bestShared && best >= 0 && Abs(int32(j-i)) < Abs(int32(best-i))) {
+				best, bestShared = j, shared
+			}
+		}
+		if best >= 0 {
+			matches[i] = best
+			matched[best] = true
+		}
+	}
+	for i, p := range old.Puzzle {
+		path := fmt.Sprintf("puzzle[%d]", i)
+		j, ok := matches[i]
+		if !ok {
+			diffs = append(diffs, &Difference{Kind: DIFF_REMOVED, Path: path, Old: puzzleSummary(p)})
+			continue
+		}
+		if i != j {
+			diffs = append(diffs, &Difference{Kind: DIFF_MOVED, Path: path, Old: fmt.Sprint(i), New: fmt.Sprint(j)})
+		}
+		diffs = append(diffs, DiffPuzzles(path, p, new.Puzzle[j], old.Size, new.Size)...)
+	}
+	for j, p := range new.Puzzle {
+		if !matched[j] {
+			diffs = append(diffs, &Difference{Kind: DIFF_ADDED, Path: fmt.Sprintf("puzzle[%d]", j), New: puzzleSummary(p)})
+		}
+	}
+	return diffs
+}
+
+// DiffPuzzles compares two puzzles, matching elements by name or, failing that, by location, and reports any change in the recomputed score.
+func DiffPuzzles(path string, old, new *perspectivego.Puzzle, oldSize, newSize uint32) []*Difference {
+	var diffs []*Difference
+	changed := func(path, o, n string) {
+		if o != n {
+			diffs = append(diffs, &Difference{Kind: DIFF_CHANGED, Path: path, Old: o, New: n})
+		}
+	}
+	changed(path+".description", old.Description, new.Description)
+	changed(path+".target", fmt.Sprint(old.Target), fmt.Sprint(new.Target))
+	changed(path+".outline", outlineString(old.Outline), outlineString(new.Outline))
+
+	oldElements := diffElements(old)
+	newElements := diffElements(new)
+	matches := make(map[int]int)
+	matched := make(map[int]bool)
+	for _, byLocation := range []bool{false, true} {
+		for i, o := range oldElements {
+			if _, ok := matches[i]; ok {
+				continue
+			}
+			for j, n := range newElements {
+				if matched[j] || o.Kind != n.Kind {
+					continue
+				}
+				if (!byLocation && o.Name == n.Name) || (byLocation && o.Location == n.Location) {
+					matches[i] = j
+					matched[j] = true
+					break
+				}
+			}
+		}
+	}
+	for i, o := range oldElements {
+		p := path + "." + o.Kind + "[" + o.Name + "]"
+		j, ok := matches[i]
+		if !ok {
+			diffs = append(diffs, &Difference{Kind: DIFF_REMOVED, Path: p, Old: o.Location})
+			continue
+		}
+		n := newElements[j]
+		changed(p+".name", o.Name, n.Name)
+		if o.Location != n.Location {
+			diffs = append(diffs, &Difference{Kind: DIFF_MOVED, Path: p + ".location", Old: o.Location, New: n.Location})
+		}
+		changed(p+".link", o.Link, n.Link)
+		changed(p+".appearance", o.Appearance, n.Appearance)
+	}
+	for j, n := range newElements {
+		if !matched[j] {
+			diffs = append(diffs, &Difference{Kind: DIFF_ADDED, Path: path + "." + n.Kind + "[" + n.Name + "]", New: n.Location})
+		}
+	}
+	changed(path+".score", scoreString(old, oldSize), scoreString(new, newSize))
+	return diffs
+}
+
+// DiffLines compares two texts line by line using their longest common subsequence.
+func DiffLines(path, old, new string) []*Difference {
+	if old == new {
+		return nil
+	}
+	a := strings.Split(old, "\n")
+	b := strings.Split(new, "\n")
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var diffs []*Difference
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			diffs = append(diffs, &Difference{Kind: DIFF_ADDED, Path: fmt.Sprintf("%s:%d", path, j+1), New: b[j]})
+			j++
+		default:
+			diffs = append(diffs, &Difference{Kind: DIFF_REMOVED, Path: fmt.Sprintf("%s:%d", path, i+1), Old: a[i]})
+			i++
+		}
+	}
+	return diffs
+}
+
+// CanonicalPuzzle returns the puzzle in text format with the elements sorted, so puzzles with the same content have the same canonical form.
+func CanonicalPuzzle(puzzle *perspectivego.Puzzle) string {
+	var buffer bytes.Buffer
+	perspectivego.WritePuzzle(&buffer, puzzle)
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+type diffElement struct {
+	Kind       string
+	Name       string
+	Location   string
+	Link       string
+	Appearance string
+}
+
+func diffElements(puzzle *perspectivego.Puzzle) []*diffElement {
+	var elements []*diffElement
+	appearance := func(mesh, colour, texture, material, shader string) string {
+		return mesh + ":" + colour + ":" + texture + ":" + material + ":" + shader
+	}
+	for _, b := range puzzle.Block {
+		elements = append(elements, &diffElement{"block", b.Name, perspectivego.LocationToString(b.Location), "", appearance(b.Mesh, b.Colour, b.Texture, b.Material, b.Shader)})
+	}
+	for _, g := range puzzle.Goal {
+		elements = append(elements, &diffElement{"goal", g.Name, perspectivego.LocationToString(g.Location), "", appearance(g.Mesh, g.Colour, g.Texture, g.Material, g.Shader)})
+	}
+	for _, p := range puzzle.Portal {
+		elements = append(elements, &diffElement{"portal", p.Name, perspectivego.LocationToString(p.Location), perspectivego.LocationToString(p.Link), appearance(p.Mesh, p.Colour, p.Texture, p.Material, p.Shader)})
+	}
+	for _, s := range puzzle.Sphere {
+		elements = append(elements, &diffElement{"sphere", s.Name, perspectivego.LocationToString(s.Location), "", appearance(s.Mesh, s.Colour, s.Texture, s.Material, s.Shader)})
+	}
+	return elements
+}
+
+func sharedElements(a, b *perspectivego.Puzzle) int {
+	locations := make(map[string]bool)
+	for _, e := range diffElements(a) {
+		locations[e.Kind+e.Location] = true
+	}
+	shared := 0
+	for _, e := range diffElements(b) {
+		if locations[e.Kind+e.Location] {
+			shared++
+		}
+	}
+	return shared
+}
+
+func outlineString(o *perspectivego.Outline) string {
+	if o == nil {
+		return ""
+	}
+	return o.Mesh + ":" + o.Colour + ":" + o.Texture + ":" + o.Material + ":" + o.Shader
+}
+
+func scoreString(puzzle *perspectivego.Puzzle, size uint32) string {
+	if len(puzzle.Sphere) == 0 {
+		return "unscored"
+	}
+	r, p := Score(puzzle, size)
+	return fmt.Sprintf("%d (penalties %d)", r, p)
+}
+
+func puzzleSummary(puzzle *perspectivego.Puzzle) string {
+	s := fmt.Sprintf("%d blocks, %d goals, %d portals, %d spheres", len(puzzle.Block), len(puzzle.Goal), len(puzzle.Portal), len(puzzle.Sphere))
+	if puzzle.Description != "" {
+		s = puzzle.Description + " (" + s + ")"
+	}
+	return s
+}
@@ -0,0 +1,536 @@
+/*
+ * Copyright 2019 Aletheia Ware LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package perspectiveeditorgo
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/AletheiaWareLLC/perspectivego"
+	"image/color"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+const (
+	BLOCK_SCALE  = 1.0
+	GOAL_SCALE   = 0.8
+	PORTAL_SCALE = 0.6
+	SPHERE_SCALE = 0.8
+)
+
+var defaultExportColour = color.NRGBA{0x80, 0x80, 0x80, 0xff}
+
+// ExportElement is a puzzle element as a primitive shape of unit size.
+type ExportElement struct {
+	Name     string
+	Colour   string
+	Sphere   bool
+	Location [3]float32
+	Scale    float32
+}
+
+// ExportLine is a line segment, used for portal links and the outline.
+type ExportLine struct {
+	Colour string
+	From   [3]float32
+	To     [3]float32
+}
+
+type exportMesh struct {
+	Positions []float32
+	Normals   []float32
+	Indices   []uint16
+}
+
+// ExportElements returns a primitive for every element in the puzzle.
+// Spheres, and elements whose mesh is named like a sphere, are exported as spheres; everything else as cubes.
+func ExportElements(puzzle *perspectivego.Puzzle) []*ExportElement {
+	var elements []*ExportElement
+	add := func(name, mesh, colour string, location *perspectivego.Location, sphere bool, scale float32) {
+		elements = append(elements, &ExportElement{
+			Name:     name,
+			Colour:   colour,
+			Sphere:   sphere || strings.Contains(strings.ToLower(mesh), "sphere"),
+			Location: exportLocation(location),
+			Scale:    scale,
+		})
+	}
+	for _, b := range puzzle.Block {
+		add(b.Name, b.Mesh, b.Colour, b.Location, false, BLOCK_SCALE)
+	}
+	for _, g := range puzzle.Goal {
+		add(g.Name, g.Mesh, g.Colour, g.Location, false, GOAL_SCALE)
+	}
+	for _, p := range puzzle.Portal {
+		add(p.Name, p.Mesh, p.Colour, p.Location, false, PORTAL_SCALE)
+	}
+	for _, s := range puzzle.Sphere {
+		add(s.Name, s.Mesh, s.Colour, s.Location, true, SPHERE_SCALE)
+	}
+	return elements
+}
+
+// ExportLines returns a line for every portal link, and the edges of the outline box enclosing a world of the given size.
+func ExportLines(puzzle *perspectivego.Puzzle, size uint32) []*ExportLine {
+	var lines []*ExportLine
+	linked := make(map[string]bool)
+	for _, p := range puzzle.Portal {
+		if IsExit(p) {
+			continue
+		}
+		link := PortalDestination(p)
+		from, to := p.Location.String(), link.String()
+		if linked[to+"-"+from] {
+			continue
+		}
+		linked[from+"-"+to] = true
+		lines = append(lines, &ExportLine{
+			Colour: p.Colour,
+			From:   exportLocation(p.Location),
+			To:     exportLocation(link),
+		})
+	}
+	colour := ""
+	if puzzle.Outline != nil {
+		colour = puzzle.Outline.Colour
+	}
+	e := float32(size/2) + 0.5
+	corners := [8][3]float32{
+		{-e, -e, -e}, {e, -e, -e}, {e, e, -e}, {-e, e, -e},
+		{-e, -e, e}, {e, -e, e}, {e, e, e}, {-e, e, e},
+	}
+	edges := [12][2]int{
+		{0, 1}, {1, 2}, {2, 3}, {3, 0},
+		{4, 5}, {5, 6}, {6, 7}, {7, 4},
+		{0, 4}, {1, 5}, {2, 6}, {3, 7},
+	}
+	for _, edge := range edges {
+		lines = append(lines, &ExportLine{
+			Colour: colour,
+			From:   corners[edge[0]],
+			To:     corners[edge[1]],
+		})
+	}
+	return lines
+}
+
+func exportLocation(l *perspectivego.Location) [3]float32 {
+	return [3]float32{float32(l.X), float32(l.Y), float32(l.Z)}
+}
+
+func exportColour(s string) color.NRGBA {
+	c, err := ParseColour(s)
+	if err != nil {
+		return defaultExportColour
+	}
+	return c
+}
+
+// MaterialName returns a name for the material of the given colour that is safe to use in OBJ and glTF files.
+func MaterialName(colour string) string {
+	if colour == "" {
+		return "default"
+	}
+	return "colour_" + exportName(colour)
+}
+
+// exportName replaces every character other than a letter or digit with an underscore.
+func exportName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+// cubeMesh returns a unit cube centred on the origin, with separate vertices per face so it is flat shaded.
+func cubeMesh() *exportMesh {
+	mesh := &exportMesh{}
+	faces := [6][3]float32{
+		{1, 0, 0}, {-1, 0, 0}, {0, 1, 0}, {0, -1, 0}, {0, 0, 1}, {0, 0, -1},
+	}
+	for _, n := range faces {
+		// Two axes perpendicular to the normal, ordered so the winding is counter-clockwise from outside
+		var u, v [3]float32
+		switch {
+		case n[0] != 0:
+			u, v = [3]float32{0, n[0], 0}, [3]float32{0, 0, 1}
+		case n[1] != 0:
+			u, v = [3]float32{0, 0, n[1]}, [3]float32{1, 0, 0}
+		default:
+			u, v = [3]float32{n[2], 0, 0}, [3]float32{0, 1, 0}
+		}
+		base := uint16(len(mesh.Positions) / 3)
+		for _, c := range [4][2]float32{{-1, -1}, {1, -1}, {1, 1}, {-1, 1}} {
+			for i := 0; i < 3; i++ {
+				mesh.Positions = append(mesh.Positions, 0.5*(n[i]+c[0]*u[i]+c[1]*v[i]))
+			}
+			mesh.Normals = append(mesh.Normals, n[0], n[1], n[2])
+		}
+		mesh.Indices = append(mesh.Indices, base, base+1, base+2, base, base+2, base+3)
+	}
+	return mesh
+}
+
+// sphereMesh returns a UV sphere of unit diameter centred on the origin.
+func sphereMesh(segments, rings int) *exportMesh {
+	mesh := &exportMesh{}
+	for r := 0; r <= rings; r++ {
+		phi := math.Pi * float64(r) / float64(rings)
+		for s := 0; s <= segments; s++ {
+			theta := 2 * math.Pi * float64(s) / float64(segments)
+			x := float32(math.Sin(phi) * math.Cos(theta))
+			y := float32(math.Cos(phi))
+			z := float32(math.Sin(phi) * math.Sin(theta))
+			mesh.Positions = append(mesh.Positions, 0.5*x, 0.5*y, 0.5*z)
+			mesh.Normals = append(mesh.Normals, x, y, z)
+		}
+	}
+	for r := 0; r < rings; r++ {
+		for s := 0; s < segments; s++ {
+			a := uint16(r*(segments+1) + s)
+			b := a + uint16(segments+1)
+			mesh.Indices = append(mesh.Indices, a, a+1, b, a+1, b+1, b)
+		}
+	}
+	return mesh
+}
+
+// WritePuzzleOBJ writes the puzzle as a Wavefront OBJ to obj, and its materials to mtl, which the OBJ refers to by mtlName.
+func WritePuzzleOBJ(obj, mtl io.Writer, mtlName string, puzzle *perspectivego.Puzzle, size uint32) error {
+	elements := ExportElements(puzzle)
+	lines := ExportLines(puzzle, size)
+	cube := cubeMesh()
+	sphere := sphereMesh(16, 8)
+
+	out := &bytes.Buffer{}
+	fmt.Fprintln(out, "mtllib", mtlName)
+	colours := make(map[string]bool)
+	vertices := 0
+	for _, e := range elements {
+		mesh := cube
+		if e.Sphere {
+			mesh = sphere
+		}
+		colours[e.Colour] = true
+		fmt.Fprintln(out, "o", exportName(e.Name))
+		fmt.Fprintln(out, "usemtl", MaterialName(e.Colour))
+		for i := 0; i < len(mesh.Positions); i += 3 {
+			fmt.Fprintf(out, "v %g %g %g\n",
+				e.Location[0]+e.Scale*mesh.Positions[i],
+				e.Location[1]+e.Scale*mesh.Positions[i+1],
+				e.Location[2]+e.Scale*mesh.Positions[i+2])
+		}
+		for i := 0; i < len(mesh.Normals); i += 3 {
+			fmt.Fprintf(out, "vn %g %g %g\n", mesh.Normals[i], mesh.Normals[i+1], mesh.Normals[i+2])
+		}
+		for i := 0; i < len(mesh.Indices); i += 3 {
+			a := vertices + int(mesh.Indices[i]) + 1
+			b := vertices + int(mesh.Indices[i+1]) + 1
+			c := vertices + int(mesh.Indices[i+2]) + 1
+			fmt.Fprintf(out, "f %d//%d %d//%d %d//%d\n", a, a, b, b, c, c)
+		}
+		vertices += len(mesh.Positions) / 3
+	}
+	fmt.Fprintln(out, "o lines")
+	for _, l := range lines {
+		colours[l.Colour] = true
+		fmt.Fprintln(out, "usemtl", MaterialName(l.Colour))
+		fmt.Fprintf(out, "v %g %g %g\n", l.From[0], l.From[1], l.From[2])
+		fmt.Fprintf(out, "v %g %g %g\n", l.To[0], l.To[1], l.To[2])
+		fmt.Fprintf(out, "l %d %d\n", vertices+1, vertices+2)
+		vertices += 2
+	}
+	if _, err := out.WriteTo(obj); err != nil {
+		return err
+	}
+
+	out.Reset()
+	for _, name := range sortedColours(colours) {
+		c := exportColour(name)
+		fmt.Fprintln(out, "newmtl", MaterialName(name))
+		fmt.Fprintf(out, "Kd %g %g %g\n", float32(c.R)/255, float32(c.G)/255, float32(c.B)/255)
+		fmt.Fprintf(out, "d %g\n", float32(c.A)/255)
+	}
+	_, err := out.WriteTo(mtl)
+	return err
+}
+
+type gltfDocument struct {
+	Asset       map[string]string `json:"asset"`
+	Scene       int               `json:"scene"`
+	Scenes      []*gltfScene      `json:"scenes"`
+	Nodes       []*gltfNode       `json:"nodes"`
+	Meshes      []*gltfMesh       `json:"meshes"`
+	Materials   []*gltfMaterial   `json:"materials"`
+	Accessors   []*gltfAccessor   `json:"accessors"`
+	BufferViews []*gltfBufferView `json:"bufferViews"`
+	Buffers     []*gltfBuffer     `json:"buffers"`
+}
+
+type gltfScene struct {
+	Nodes []int `json:"nodes"`
+}
+
+type gltfNode struct {
+	Name        string    `json:"name,omitempty"`
+	Mesh        int       `json:"mesh"`
+	Translation []float32 `json:"translation,omitempty"`
+	Scale       []float32 `json:"scale,omitempty"`
+}
+
+type gltfMesh struct {
+	Name       string           `json:"name,omitempty"`
+	Primitives []*gltfPrimitive `json:"primitives"`
+}
+
+type gltfPrimitive struct {
+	Attributes map[string]int `json:"attributes"`
+	Indices    int            `json:"indices"`
+	Material   int            `json:"material"`
+	Mode       int            `json:"mode"`
+}
+
+type gltfMaterial struct {
+	Name                 string                 `json:"name"`
+	PbrMetallicRoughness map[string]interface{} `json:"pbrMetallicRoughness"`
+	AlphaMode            string                 `json:"alphaMode,omitempty"`
+}
+
+type gltfAccessor struct {
+	BufferView    int       `json:"bufferView"`
+	ComponentType int       `json:"componentType"`
+	Count         int       `json:"count"`
+	Type          string    `json:"type"`
+	Min           []float32 `json:"min,omitempty"`
+	Max           []float32 `json:"max,omitempty"`
+}
+
+type gltfBufferView struct {
+	Buffer     int `json:"buffer"`
+	ByteOffset int `json:"byteOffset"`
+	ByteLength int `json:"byteLength"`
+	Target     int `json:"target"`
+}
+
+type gltfBuffer struct {
+	ByteLength int    `json:"byteLength"`
+	URI        string `json:"uri"`
+}
+
+const (
+	gltfFloat         = 5126
+	gltfUnsignedShort = 5123
+	gltfArrayBuffer   = 34962
+	gltfElementBuffer = 34963
+	gltfLines         = 1
+	gltfTriangles     = 4
+)
+
+type gltfBuilder struct {
+	document  *gltfDocument
+	buffer    bytes.Buffer
+	materials map[string]int
+}
+
+func (b *gltfBuilder) view(data interface{}, target int) int {
+	// Align every view to 4 bytes as required for float components
+	for b.buffer.Len()%4 != 0 {
+		b.buffer.WriteByte(0)
+	}
+	offset := b.buffer.Len()
+	binary.Write(&b.buffer, binary.LittleEndian, data)
+	b.document.BufferViews = append(b.document.BufferViews, &gltfBufferView{
+		ByteOffset: offset,
+		ByteLength: b.buffer.Len() - offset,
+		Target:     target,
+	})
+	return len(b.document.BufferViews) - 1
+}
+
+func (b *gltfBuilder) vectors(data []float32, bounds bool) int {
+	accessor := &gltfAccessor{
+		BufferView:    b.view(data, gltfArrayBuffer),
+		ComponentType: gltfFloat,
+		Count:         len(data) / 3,
+		Type:          "VEC3",
+	}
+	if bounds {
+		accessor.Min = []float32{math.MaxFloat32, math.MaxFloat32, math.MaxFloat32}
+		accessor.Max = []float32{-math.MaxFloat32, -math.MaxFloat32, -math.MaxFloat32}
+		for i, v := range data {
+			if v < accessor.Min[i%3] {
+				accessor.Min[i%3] = v
+			}
+			if v > accessor.Max[i%3] {
+				accessor.Max[i%3] = v
+			}
+		}
+	}
+	b.document.Accessors = append(b.document.Accessors, accessor)
+	return len(b.document.Accessors) - 1
+}
+
+func (b *gltfBuilder) indices(data []uint16) int {
+	b.document.Accessors = append(b.document.Accessors, &gltfAccessor{
+		BufferView:    b.view(data, gltfElementBuffer),
+		ComponentType: gltfUnsignedShort,
+		Count:         len(data),
+		Type:          "SCALAR",
+	})
+	return len(b.document.Accessors) - 1
+}
+
+func (b *gltfBuilder) material(colour string) int {
+	if m, ok := b.materials[colour]; ok {
+		return m
+	}
+	c := exportColour(colour)
+	material := &gltfMaterial{
+		Name: MaterialName(colour),
+		PbrMetallicRoughness: map[string]interface{}{
+			"baseColorFactor": []float32{float32(c.R) / 255, float32(c.G) / 255, float32(c.B) / 255, float32(c.A) / 255},
+			"metallicFactor":  0,
+			"roughnessFactor": 1,
+		},
+	}
+	if c.A < 0xff {
+		material.AlphaMode = "BLEND"
+	}
+	b.document.Materials = append(b.document.Materials, material)
+	b.materials[colour] = len(b.document.Materials) - 1
+	return b.materials[colour]
+}
+
+// WritePuzzleGLTF writes the puzzle as a self contained glTF 2.0 file with an embedded buffer.
+func WritePuzzleGLTF(writer io.Writer, puzzle *perspectivego.Puzzle, size uint32) error {
+	b := &gltfBuilder{
+		document: &gltfDocument{
+			Asset: map[string]string{
+				"version":   "2.0",
+				"generator": "perspectiveeditorgo",
+			},
+			Scenes: []*gltfScene{{}},
+		},
+		materials: make(map[string]int),
+	}
+	type shape struct {
+		positions, normals, indices int
+	}
+	shapes := make(map[bool]*shape)
+	for _, sphere := range []bool{false, true} {
+		mesh := cubeMesh()
+		if sphere {
+			mesh = sphereMesh(16, 8)
+		}
+		shapes[sphere] = &shape{
+			positions: b.vectors(mesh.Positions, true),
+			normals:   b.vectors(mesh.Normals, false),
+			indices:   b.indices(mesh.Indices),
+		}
+	}
+	// Share one mesh between all elements with the same shape and colour
+	meshes := make(map[string]int)
+	for _, e := range ExportElements(puzzle) {
+		key := fmt.Sprint(e.Sphere, e.Colour)
+		m, ok := meshes[key]
+		if !ok {
+			s := shapes[e.Sphere]
+			b.document.Meshes = append(b.document.Meshes, &gltfMesh{
+				Primitives: []*gltfPrimitive{{
+					Attributes: map[string]int{
+						"POSITION": s.positions,
+						"NORMAL":   s.normals,
+					},
+					Indices:  s.indices,
+					Material: b.material(e.Colour),
+					Mode:     gltfTriangles,
+				}},
+			})
+			m = len(b.document.Meshes) - 1
+			meshes[key] = m
+		}
+		b.document.Nodes = append(b.document.Nodes, &gltfNode{
+			Name:        e.Name,
+			Mesh:        m,
+			Translation: e.Location[:],
+			Scale:       []float32{e.Scale, e.Scale, e.Scale},
+		})
+	}
+	// Group lines into one primitive per colour
+	lines := make(map[string][]float32)
+	for _, l := range ExportLines(puzzle, size) {
+		lines[l.Colour] = append(lines[l.Colour], l.From[0], l.From[1], l.From[2], l.To[0], l.To[1], l.To[2])
+	}
+	if len(lines) > 0 {
+		mesh := &gltfMesh{
+			Name: "lines",
+		}
+		colours := make(map[string]bool, len(lines))
+		for c := range lines {
+			colours[c] = true
+		}
+		for _, colour := range sortedColours(colours) {
+			positions := lines[colour]
+			indices := make([]uint16, len(positions)/3)
+			for i := range indices {
+				indices[i] = uint16(i)
+			}
+			mesh.Primitives = append(mesh.Primitives, &gltfPrimitive{
+				Attributes: map[string]int{
+					"POSITION": b.vectors(positions, true),
+				},
+				Indices:  b.indices(indices),
+				Material: b.material(colour),
+				Mode:     gltfLines,
+			})
+		}
+		b.document.Meshes = append(b.document.Meshes, mesh)
+		b.document.Nodes = append(b.document.Nodes, &gltfNode{
+			Name: "lines",
+			Mesh: len(b.document.Meshes) - 1,
+		})
+	}
+	for i := range b.document.Nodes {
+		b.document.Scenes[0].Nodes = append(b.document.Scenes[0].Nodes, i)
+	}
+	b.document.Buffers = []*gltfBuffer{{
+		ByteLength: b.buffer.Len(),
+		URI:        "data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString(b.buffer.Bytes()),
+	}}
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(b.document)
+}
+
+func sortedColours(colours map[string]bool) []string {
+	keys := make([]string, 0, len(colours))
+	for k := range colours {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
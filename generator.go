@@ -23,18 +23,72 @@ import (
 	"time"
 )
 
+// ElementStyle holds the appearance of one kind of element.
+// Each list is cycled through as elements are created, so a list of one gives every element the same value.
+type ElementStyle struct {
+	Mesh     []string
+	Colour   []string
+	Texture  []string
+	Material []string
+	Shader   string
+}
+
+// Valid returns false if any list is empty.
+func (s *ElementStyle) Valid() bool {
+	return len(s.Mesh) > 0 && len(s.Colour) > 0 && len(s.Texture) > 0 && len(s.Material) > 0
+}
+
 func Generate(puzzle *perspectivego.Puzzle, size uint32,
 	goalCount int, goalMesh, goalColour, goalTexture, goalMaterial []string, goalShader string,
 	sphereCount int, sphereMesh, sphereColour, sphereTexture, sphereMaterial []string, sphereShader string,
 	blockCount int, blockMesh, blockColour, blockTexture, blockMaterial []string, blockShader string,
 	portalCount int, portalMesh, portalColour, portalTexture, portalMaterial []string, portalShader string) *perspectivego.Puzzle {
-	rand.Seed(time.Now().UnixNano())
+	return GenerateSeeded(time.Now().UnixNano(), puzzle, size,
+		goalCount, goalMesh, goalColour, goalTexture, goalMaterial, goalShader,
+		sphereCount, sphereMesh, sphereColour, sphereTexture, sphereMaterial, sphereShader,
+		blockCount, blockMesh, blockColour, blockTexture, blockMaterial, blockShader,
+		portalCount, portalMesh, portalColour, portalTexture, portalMaterial, portalShader)
+}
+
+// GenerateSeeded is like Generate but seeds the random number generator with the given seed so the same seed always produces the same puzzle.
+func GenerateSeeded(seed int64, puzzle *perspectivego.Puzzle, size uint32,
+	goalCount int, goalMesh, goalColour, goalTexture, goalMaterial []string, goalShader string,
+	sphereCount int, sphereMesh, sphereColour, sphereTexture, sphereMaterial []string, sphereShader string,
+	blockCount int, blockMesh, blockColour, blockTexture, blockMaterial []string, blockShader string,
+	portalCount int, portalMesh, portalColour, portalTexture, portalMaterial []string, portalShader string) *perspectivego.Puzzle {
+	return GenerateTopology(seed, DefaultPortalTopology(), puzzle, size,
+		goalCount, goalMesh, goalColour, goalTexture, goalMaterial, goalShader,
+		sphereCount, sphereMesh, sphereColour, sphereTexture, sphereMaterial, sphereShader,
+		blockCount, blockMesh, blockColour, blockTexture, blockMaterial, blockShader,
+		portalCount, portalMesh, portalColour, portalTexture, portalMaterial, portalShader)
+}
+
+// GenerateTopology is like GenerateSeeded but links portals according to the given topology, with portal colours, textures and materials advancing once per group.
+func GenerateTopology(seed int64, topology *PortalTopology, puzzle *perspectivego.Puzzle, size uint32,
+	goalCount int, goalMesh, goalColour, goalTexture, goalMaterial []string, goalShader string,
+	sphereCount int, sphereMesh, sphereColour, sphereTexture, sphereMaterial []string, sphereShader string,
+	blockCount int, blockMesh, blockColour, blockTexture, blockMaterial []string, blockShader string,
+	portalCount int, portalMesh, portalColour, portalTexture, portalMaterial []string, portalShader string) *perspectivego.Puzzle {
+	return GenerateVolume(seed, topology, puzzle, CubeVolume(size),
+		goalCount, goalMesh, goalColour, goalTexture, goalMaterial, goalShader,
+		sphereCount, sphereMesh, sphereColour, sphereTexture, sphereMaterial, sphereShader,
+		blockCount, blockMesh, blockColour, blockTexture, blockMaterial, blockShader,
+		portalCount, portalMesh, portalColour, portalTexture, portalMaterial, portalShader)
+}
+
+// GenerateVolume is like GenerateTopology but places elements within the given volume, which need not be a cube.
+func GenerateVolume(seed int64, topology *PortalTopology, puzzle *perspectivego.Puzzle, volume *Volume,
+	goalCount int, goalMesh, goalColour, goalTexture, goalMaterial []string, goalShader string,
+	sphereCount int, sphereMesh, sphereColour, sphereTexture, sphereMaterial []string, sphereShader string,
+	blockCount int, blockMesh, blockColour, blockTexture, blockMaterial []string, blockShader string,
+	portalCount int, portalMesh, portalColour, portalTexture, portalMaterial []string, portalShader string) *perspectivego.Puzzle {
+	rand.Seed(seed)
 
 	occupied := make(map[string]bool, goalCount+blockCount+sphereCount+portalCount)
 	if goalCount > 0 {
 		puzzle.Goal = make([]*perspectivego.Goal, 0, goalCount)
 		for i := 0; i < goalCount; i++ {
-			location := GenerateLocation(occupied, size)
+			location := GenerateVolumeLocation(occupied, volume)
 			goal := &perspectivego.Goal{
 				Name:     "g" + strconv.Itoa(i),
 				Mesh:     goalMesh[i%len(goalMesh)],
@@ -50,7 +104,7 @@ func Generate(puzzle *perspectivego.Puzzle, size uint32,
 	if blockCount > 0 {
 		puzzle.Block = make([]*perspectivego.Block, 0, blockCount)
 		for i := 0; i < blockCount; i++ {
-			location := GenerateLocation(occupied, size)
+			location := GenerateVolumeLocation(occupied, volume)
 			block := &perspectivego.Block{
 				Name:     "b" + strconv.Itoa(i),
 				Mesh:     blockMesh[i%len(blockMesh)],
@@ -66,7 +120,7 @@ func Generate(puzzle *perspectivego.Puzzle, size uint32,
 	if sphereCount > 0 {
 		puzzle.Sphere = make([]*perspectivego.Sphere, 0, sphereCount)
 		for i := 0; i < sphereCount; i++ {
-			location := GenerateLocation(occupied, size)
+			location := GenerateVolumeLocation(occupied, volume)
 			sphere := &perspectivego.Sphere{
 				Name:     "s" + strconv.Itoa(i),
 				Mesh:     sphereMesh[i%len(sphereMesh)],
@@ -81,44 +135,27 @@ func Generate(puzzle *perspectivego.Puzzle, size uint32,
 	}
 	if portalCount > 0 {
 		puzzle.Portal = make([]*perspectivego.Portal, 0, portalCount)
-		var previous *perspectivego.Portal
 		for i := 0; i < portalCount; i++ {
-			location := GenerateLocation(occupied, size)
+			group := i / topology.GroupSize
+			location := GenerateVolumeLocation(occupied, volume)
 			portal := &perspectivego.Portal{
 				Name:     "p" + strconv.Itoa(i),
 				Mesh:     portalMesh[i%len(portalMesh)],
-				Colour:   portalColour[(i/2)%len(portalColour)],
+				Colour:   portalColour[group%len(portalColour)],
 				Location: location,
-				Texture:  portalTexture[(i/2)%len(portalTexture)],
-				Material: portalMaterial[(i/2)%len(portalMaterial)],
+				Texture:  portalTexture[group%len(portalTexture)],
+				Material: portalMaterial[group%len(portalMaterial)],
 				Shader:   portalShader,
 			}
-			if previous == nil {
-				previous = portal
-			} else {
-				portal.Link = previous.Location
-				previous.Link = portal.Location
-				previous = nil
-			}
 			puzzle.Portal = append(puzzle.Portal, portal)
 		}
+		LinkPortals(puzzle.Portal, topology)
 	}
 	return puzzle
 }
 
 func GenerateLocation(occupied map[string]bool, size uint32) *perspectivego.Location {
-	location := &perspectivego.Location{}
-	var key string
-	for {
-		location.X = int32(RandomLocation(size))
-		location.Y = int32(RandomLocation(size))
-		location.Z = int32(RandomLocation(size))
-		key = location.String()
-		if !occupied[key] {
-			occupied[key] = true
-			return location
-		}
-	}
+	return GenerateVolumeLocation(occupied, CubeVolume(size))
 }
 
 func RandomLocation(size uint32) int {
@@ -3,7 +3,8 @@ module github.com/AletheiaWareLLC/perspectiveeditorgo
 go 1.14
 
 require (
+	github.com/AletheiaWareLLC/joygo v0.0.0-20200512002833-3f4841a59436
 	github.com/AletheiaWareLLC/perspectivego v0.0.0-20200706175216-d7edb168aa05
-	github.com/golang/protobuf v1.4.2 // indirect
-	google.golang.org/protobuf v1.25.0 // indirect
+	github.com/golang/protobuf v1.4.2
+	google.golang.org/protobuf v1.25.0
 )
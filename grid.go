@@ -0,0 +1,328 @@
+/*
+ * Copyright 2019 Aletheia Ware LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package perspectiveeditorgo
+
+import (
+	"github.com/AletheiaWareLLC/perspectivego"
+)
+
+// GRID_UNTESTED marks a cell and direction the grid scorer has not yet scored
+const GRID_UNTESTED = -2
+
+// gridDirections holds the X, Y and Z components of each of the directions, in the same order
+var gridDirections = [6][3]int32{
+	{-1, 0, 0},
+	{1, 0, 0},
+	{0, -1, 0},
+	{0, 1, 0},
+	{0, 0, -1},
+	{0, 0, 1},
+}
+
+const gridDown = 2
+
+type gridPortal struct {
+	// Destination is the cell index of the link, and X, Y, Z its coordinates
+	Destination int32
+	X, Y, Z     int32
+	// Gravity is the index of the direction of gravity on leaving, or -1 to keep gravity
+	Gravity int
+}
+
+type gridUsage struct {
+	Generation uint32
+	Count      int
+}
+
+// GridScorer scores puzzles with the same results as ScoreBounds, but over dense arrays indexed by cell instead of maps keyed by location strings.
+// The arrays are reused from one puzzle to the next, so scoring a puzzle no larger than the last allocates nothing.
+// A GridScorer is not safe for concurrent use.
+type GridScorer struct {
+	Bounds *Bounds
+	// min is the lowest corner of the grid, dims the number of cells along each axis, and strides the index offset of each direction
+	min     [3]int32
+	dims    [3]int32
+	strides [6]int32
+	blocks  []bool
+	goals   []bool
+	visited []bool
+	// portalAt holds the index into portals of the enterable portal in each cell, or -1
+	portalAt []int32
+	portals  []gridPortal
+	// tested holds the rotations from each cell and direction, indexed by cell * 6 + direction
+	tested []int32
+	// usage and wraps are only valid where their generation matches that of the current walk, so they need not be cleared between walks
+	usage      []gridUsage
+	wraps      []uint32
+	generation uint32
+}
+
+func NewGridScorer(bounds *Bounds) *GridScorer {
+	return &GridScorer{
+		Bounds: bounds,
+	}
+}
+
+// ScoreGrid is like ScoreBounds but uses a GridScorer; reuse a GridScorer directly to avoid reallocating its arrays for each puzzle.
+func ScoreGrid(puzzle *perspectivego.Puzzle, bounds *Bounds) (int, int) {
+	return NewGridScorer(bounds).Score(puzzle)
+}
+
+// Score returns the rotations and penalty of the puzzle, exactly as ScoreBounds would.
+func (g *GridScorer) Score(puzzle *perspectivego.Puzzle) (int, int) {
+	if len(puzzle.Sphere) == 0 {
+		return BAD, len(puzzle.Block) + len(puzzle.Portal)
+	}
+	g.reset(puzzle)
+	sphere := puzzle.Sphere[0].Location
+	rotations, direction := g.scoreDirections(g.index(sphere.X, sphere.Y, sphere.Z), sphere.X, sphere.Y, sphere.Z, false)
+	if direction != gridDown {
+		// Add initial rotation
+		rotations += 1
+	}
+	penalty := 0
+	for _, b := range puzzle.Block {
+		if !g.visited[g.index(b.Location.X, b.Location.Y, b.Location.Z)] {
+			penalty++
+		}
+	}
+	for _, p := range puzzle.Portal {
+		if !g.visited[g.index(p.Location.X, p.Location.Y, p.Location.Z)] {
+			penalty++
+		}
+	}
+	return rotations, penalty
+}
+
+// reset sizes the grid to cover the bounds, a margin of one cell around them, and every element and link, then fills it from the puzzle.
+func (g *GridScorer) reset(puzzle *perspectivego.Puzzle) {
+	lo := [3]int32{g.Bounds.Min[0] - 1, g.Bounds.Min[1] - 1, g.Bounds.Min[2] - 1}
+	hi := [3]int32{g.Bounds.Max[0] + 1, g.Bounds.Max[1] + 1, g.Bounds.Max[2] + 1}
+	include := func(l *perspectivego.Location) {
+		for i, c := range [3]int32{l.X, l.Y, l.Z} {
+			if c < lo[i] {
+				lo[i] = c
+			}
+			if c > hi[i] {
+				hi[i] = c
+			}
+		}
+	}
+	for _, s := range puzzle.Sphere {
+		include(s.Location)
+	}
+	for _, b := range puzzle.Block {
+		include(b.Location)
+	}
+	for _, o := range puzzle.Goal {
+		include(o.Location)
+	}
+	for _, p := range puzzle.Portal {
+		include(p.Location)
+		if p.Link != nil {
+			include(p.Link)
+		}
+	}
+	g.min = lo
+	for i := range g.dims {
+		g.dims[i] = hi[i] - lo[i] + 1
+	}
+	sx := g.dims[1] * g.dims[2]
+	sy := g.dims[2]
+	g.strides = [6]int32{-sx, sx, -sy, sy, -1, 1}
+
+	cells := int(g.dims[0]) * int(g.dims[1]) * int(g.dims[2])
+	if cap(g.blocks) < cells {
+		g.blocks = make([]bool, cells)
+		g.goals = make([]bool, cells)
+		g.visited = make([]bool, cells)
+		g.portalAt = make([]int32, cells)
+		g.tested = make([]int32, cells*len(gridDirections))
+		g.usage = make([]gridUsage, cells)
+		g.wraps = make([]uint32, cells*len(gridDirections))
+		g.generation = 0
+	} else {
+		g.blocks = g.blocks[:cells]
+		g.goals = g.goals[:cells]
+		g.visited = g.visited[:cells]
+		g.portalAt = g.portalAt[:cells]
+		g.tested = g.tested[:cells*len(gridDirections)]
+		g.usage = g.usage[:cells]
+		g.wraps = g.wraps[:cells*len(gridDirections)]
+		for i := range g.blocks {
+			g.blocks[i] = false
+			g.goals[i] = false
+			g.visited[i] = false
+		}
+	}
+	for i := range g.portalAt {
+		g.portalAt[i] = -1
+	}
+	for i := range g.tested {
+		g.tested[i] = GRID_UNTESTED
+	}
+	for _, b := range puzzle.Block {
+		g.blocks[g.index(b.Location.X, b.Location.Y, b.Location.Z)] = true
+	}
+	for _, o := range puzzle.Goal {
+		g.goals[g.index(o.Location.X, o.Location.Y, o.Location.Z)] = true
+	}
+	g.portals = g.portals[:0]
+	for _, p := range puzzle.Portal {
+		// Exits can be arrived at but not entered
+		if IsExit(p) {
+			continue
+		}
+		gravity := -1
+		if d := PortalGravity(p); d != nil {
+			gravity = directionIndex(d)
+		}
+		g.portalAt[g.index(p.Location.X, p.Location.Y, p.Location.Z)] = int32(len(g.portals))
+		g.portals = append(g.portals, gridPortal{
+			Destination: g.index(p.Link.X, p.Link.Y, p.Link.Z),
+			X:           p.Link.X,
+			Y:           p.Link.Y,
+			Z:           p.Link.Z,
+			Gravity:     gravity,
+		})
+	}
+}
+
+func (g *GridScorer) index(x, y, z int32) int32 {
+	return ((x-g.min[0])*g.dims[1]+(y-g.min[1]))*g.dims[2] + (z - g.min[2])
+}
+
+func (g *GridScorer) contains(x, y, z int32) bool {
+	b := g.Bounds
+	return x >= b.Min[0] && x <= b.Max[0] && y >= b.Min[1] && y <= b.Max[1] && z >= b.Min[2] && z <= b.Max[2]
+}
+
+// nextGeneration starts a new walk, clearing usage and wraps only when the generation counter overflows.
+func (g *GridScorer) nextGeneration() uint32 {
+	g.generation++
+	if g.generation == 0 {
+		for i := range g.usage {
+			g.usage[i] = gridUsage{}
+		}
+		for i := range g.wraps {
+			g.wraps[i] = 0
+		}
+		g.generation = 1
+	}
+	return g.generation
+}
+
+func (g *GridScorer) scoreDirections(cell, x, y, z int32, portaled bool) (int, int) {
+	min := BAD
+	dir := gridDown
+	for d := range gridDirections {
+		t := int(cell)*len(gridDirections) + d
+		rotations := int(g.tested[t])
+		if rotations == GRID_UNTESTED {
+			g.tested[t] = BAD // Set now, update later to avoid loops
+			rotations = g.scoreDirection(d, x, y, z, portaled)
+			g.tested[t] = int32(rotations)
+		}
+		if rotations >= 0 && (rotations < min || min == BAD) {
+			min = rotations
+			dir = d
+		}
+	}
+	return min, dir
+}
+
+func (g *GridScorer) scoreDirection(direction int, x, y, z int32, portaled bool) int {
+	generation := g.nextGeneration()
+	for {
+		if !g.contains(x, y, z) {
+			return BAD
+		}
+		cell := g.index(x, y, z)
+		if g.goals[cell] {
+			return 0
+		}
+		if !portaled {
+			if p := g.portalAt[cell]; p >= 0 {
+				usage := &g.usage[cell]
+				if usage.Generation != generation {
+					usage.Generation = generation
+					usage.Count = 0
+				}
+				if usage.Count >= MAX_PORTAL_USES {
+					return BAD
+				}
+				usage.Count++
+				portal := &g.portals[p]
+				x, y, z = portal.X, portal.Y, portal.Z
+				if portal.Gravity >= 0 {
+					direction = portal.Gravity
+				}
+				portaled = true
+				g.visited[cell] = true
+				g.visited[portal.Destination] = true
+				continue
+			}
+		}
+		d := gridDirections[direction]
+		nx, ny, nz := x+d[0], y+d[1], z+d[2]
+		next := cell + g.strides[direction]
+		wrapped := false
+		if model := g.Bounds.Model; model == BOUNDS_WALL || model == BOUNDS_WRAP {
+			if !g.contains(nx, ny, nz) {
+				if model == BOUNDS_WALL {
+					r, _ := g.scoreDirections(cell, x, y, z, portaled)
+					if r >= 0 {
+						return r + GOOD
+					}
+					return r
+				}
+				nx, ny, nz = g.wrap(nx, ny, nz)
+				next = g.index(nx, ny, nz)
+				wrapped = true
+			}
+		}
+		if g.blocks[next] {
+			g.visited[next] = true
+			r, _ := g.scoreDirections(cell, x, y, z, portaled)
+			if r >= 0 {
+				return r + GOOD
+			}
+			return r
+		}
+		if wrapped {
+			w := int(next)*len(gridDirections) + direction
+			if g.wraps[w] == generation {
+				return BAD
+			}
+			g.wraps[w] = generation
+		}
+		x, y, z = nx, ny, nz
+		portaled = false
+	}
+}
+
+func (g *GridScorer) wrap(x, y, z int32) (int32, int32, int32) {
+	c := [3]int32{x, y, z}
+	for i := range c {
+		if c[i] < g.Bounds.Min[i] {
+			c[i] = g.Bounds.Max[i]
+		} else if c[i] > g.Bounds.Max[i] {
+			c[i] = g.Bounds.Min[i]
+		}
+	}
+	return c[0], c[1], c[2]
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright 2019 Aletheia Ware LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package perspectiveeditorgo
+
+import (
+	"github.com/AletheiaWareLLC/perspectivego"
+	"testing"
+)
+
+func generateTestPuzzle(seed int64, volume *Volume, topology *PortalTopology, blocks, portals int) *perspectivego.Puzzle {
+	s := []string{"box"}
+	return GenerateVolume(seed, topology, &perspectivego.Puzzle{}, volume,
+		1, s, s, s, s, "",
+		1, s, s, s, s, "",
+		blocks, s, s, s, s, "",
+		portals, s, s, s, s, "")
+}
+
+func TestGridScorerMatchesScore(t *testing.T) {
+	volumes := []*Volume{CubeVolume(5), CubeVolume(7), {Width: 3, Height: 9, Depth: 5}}
+	topologies := []*PortalTopology{
+		DefaultPortalTopology(),
+		{GroupSize: 3, OneWay: true, Reorient: 0.5},
+	}
+	for _, volume := range volumes {
+		for _, model := range BoundsModels() {
+			bounds, err := volume.Bounds(model)
+			if err != nil {
+				t.Fatal(err)
+			}
+			scorer := NewGridScorer(bounds)
+			for _, topology := range topologies {
+				for seed := int64(0); seed < 50; seed++ {
+					puzzle := generateTestPuzzle(seed, volume, topology, 8+int(seed%8), 6)
+					r1, p1 := ScoreBounds(puzzle, bounds)
+					r2, p2 := scorer.Score(puzzle)
+					if r1 != r2 || p1 != p2 {
+						t.Fatalf("%s %s seed %d: expected %d %d, got %d %d", volume, model, seed, r1, p1, r2, p2)
+					}
+				}
+			}
+		}
+	}
+}
+
+func benchmarkPuzzles() []*perspectivego.Puzzle {
+	var puzzles []*perspectivego.Puzzle
+	for seed := int64(0); seed < 64; seed++ {
+		puzzles = append(puzzles, generateTestPuzzle(seed, CubeVolume(7), DefaultPortalTopology(), 20, 4))
+	}
+	return puzzles
+}
+
+func BenchmarkScore(b *testing.B) {
+	puzzles := benchmarkPuzzles()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Score(puzzles[i%len(puzzles)], 7)
+	}
+}
+
+func BenchmarkScoreGrid(b *testing.B) {
+	puzzles := benchmarkPuzzles()
+	bounds := LegacyBounds(7)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ScoreGrid(puzzles[i%len(puzzles)], bounds)
+	}
+}
+
+func BenchmarkGridScorer(b *testing.B) {
+	puzzles := benchmarkPuzzles()
+	scorer := NewGridScorer(LegacyBounds(7))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		scorer.Score(puzzles[i%len(puzzles)])
+	}
+}
+
+func BenchmarkGridScorerFall(b *testing.B) {
+	puzzles := benchmarkPuzzles()
+	bounds, _ := CubeVolume(7).Bounds(BOUNDS_FALL)
+	scorer := NewGridScorer(bounds)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		scorer.Score(puzzles[i%len(puzzles)])
+	}
+}
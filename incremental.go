@@ -0,0 +1,513 @@
+/*
+ * Copyright 2019 Aletheia Ware LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package perspectiveeditorgo
+
+import (
+	"errors"
+	"github.com/AletheiaWareLLC/perspectivego"
+	"strconv"
+	"strings"
+)
+
+type cell [3]int32
+
+func cellOf(location *perspectivego.Location) cell {
+	return cell{location.X, location.Y, location.Z}
+}
+
+// walkKey identifies a walk by where it starts, the index of its gravity direction, and whether the sphere has just left a portal.
+type walkKey struct {
+	Cell      cell
+	Direction int
+	Portaled  bool
+}
+
+// walkResult is the outcome of a walk, as ScoreDirection would find it, along with every cell whose contents it depends on.
+type walkResult struct {
+	Outcome  int
+	Rest     cell
+	Portaled bool
+	Visited  []cell
+	Touched  []cell
+}
+
+// IncrementalScorer keeps the walks between resting states of a puzzle so that, after an element is added, removed or moved,
+// only the walks passing through or stopping against the changed cells are simulated again.
+// Score returns the same results as ScoreBounds for the edited puzzle.
+type IncrementalScorer struct {
+	Puzzle *perspectivego.Puzzle
+	Bounds *Bounds
+	// Walks counts the walks simulated, to show how much each edit invalidated
+	Walks   int
+	blocks  map[cell]int
+	goals   map[cell]int
+	portals map[cell][]*perspectivego.Portal
+	walks   map[walkKey]*walkResult
+	touches map[cell]map[walkKey]*walkResult
+	// tested and visited hold the state of the current Score
+	tested  map[walkKey]int
+	visited map[cell]bool
+}
+
+// NewIncrementalScorer returns a scorer for the puzzle, which it edits in place.
+func NewIncrementalScorer(puzzle *perspectivego.Puzzle, bounds *Bounds) *IncrementalScorer {
+	s := &IncrementalScorer{
+		Puzzle:  puzzle,
+		Bounds:  bounds,
+		blocks:  make(map[cell]int),
+		goals:   make(map[cell]int),
+		portals: make(map[cell][]*perspectivego.Portal),
+		walks:   make(map[walkKey]*walkResult),
+		touches: make(map[cell]map[walkKey]*walkResult),
+	}
+	for _, b := range puzzle.Block {
+		s.blocks[cellOf(b.Location)]++
+	}
+	for _, g := range puzzle.Goal {
+		s.goals[cellOf(g.Location)]++
+	}
+	for _, p := range puzzle.Portal {
+		s.addPortal(p)
+	}
+	return s
+}
+
+// Score returns the rotations and penalty of the puzzle as it stands, simulating only the walks not kept from earlier scores.
+func (s *IncrementalScorer) Score() (int, int) {
+	if len(s.Puzzle.Sphere) == 0 {
+		return BAD, len(s.Puzzle.Block) + len(s.Puzzle.Portal)
+	}
+	s.tested = make(map[walkKey]int)
+	s.visited = make(map[cell]bool)
+	rotations, direction := s.scoreDirections(cellOf(s.Puzzle.Sphere[0].Location), false)
+	if directions[direction] != down {
+		// Add initial rotation
+		rotations += 1
+	}
+	penalty := 0
+	for _, b := range s.Puzzle.Block {
+		if !s.visited[cellOf(b.Location)] {
+			penalty++
+		}
+	}
+	for _, p := range s.Puzzle.Portal {
+		if !s.visited[cellOf(p.Location)] {
+			penalty++
+		}
+	}
+	return rotations, penalty
+}
+
+// AddBlock adds the block to the puzzle.
+func (s *IncrementalScorer) AddBlock(block *perspectivego.Block) {
+	s.Puzzle.Block = append(s.Puzzle.Block, block)
+	s.blocks[cellOf(block.Location)]++
+	s.invalidate(cellOf(block.Location))
+}
+
+// AddGoal adds the goal to the puzzle.
+func (s *IncrementalScorer) AddGoal(goal *perspectivego.Goal) {
+	s.Puzzle.Goal = append(s.Puzzle.Goal, goal)
+	s.goals[cellOf(goal.Location)]++
+	s.invalidate(cellOf(goal.Location))
+}
+
+// AddSphere adds the sphere to the puzzle; only the first sphere is scored.
+func (s *IncrementalScorer) AddSphere(sphere *perspectivego.Sphere) {
+	s.Puzzle.Sphere = append(s.Puzzle.Sphere, sphere)
+}
+
+// AddPortal adds the portal to the puzzle.
+func (s *IncrementalScorer) AddPortal(portal *perspectivego.Portal) {
+	s.Puzzle.Portal = append(s.Puzzle.Portal, portal)
+	s.addPortal(portal)
+	s.invalidate(cellOf(portal.Location))
+}
+
+// Remove removes the first goal, block, sphere or portal with the given name from the puzzle.
+func (s *IncrementalScorer) Remove(name string) error {
+	for i, g := range s.Puzzle.Goal {
+		if g.Name == name {
+			s.Puzzle.Goal = append(s.Puzzle.Goal[:i], s.Puzzle.Goal[i+1:]...)
+			s.goals[cellOf(g.Location)]--
+			s.invalidate(cellOf(g.Location))
+			return nil
+		}
+	}
+	for i, b := range s.Puzzle.Block {
+		if b.Name == name {
+			s.Puzzle.Block = append(s.Puzzle.Block[:i], s.Puzzle.Block[i+1:]...)
+			s.blocks[cellOf(b.Location)]--
+			s.invalidate(cellOf(b.Location))
+			return nil
+		}
+	}
+	for i, sphere := range s.Puzzle.Sphere {
+		if sphere.Name == name {
+			s.Puzzle.Sphere = append(s.Puzzle.Sphere[:i], s.Puzzle.Sphere[i+1:]...)
+			return nil
+		}
+	}
+	for i, p := range s.Puzzle.Portal {
+		if p.Name == name {
+			s.Puzzle.Portal = append(s.Puzzle.Portal[:i], s.Puzzle.Portal[i+1:]...)
+			s.removePortal(p)
+			s.invalidate(cellOf(p.Location))
+			return nil
+		}
+	}
+	return errors.New("No such element: " + name)
+}
+
+// Move moves the first goal, block, sphere or portal with the given name to the given location.
+// Links are left unchanged, except that an exit remains an exit.
+func (s *IncrementalScorer) Move(name string, location *perspectivego.Location) error {
+	to := &perspectivego.Location{
+		X: location.X,
+		Y: location.Y,
+		Z: location.Z,
+	}
+	for _, g := range s.Puzzle.Goal {
+		if g.Name == name {
+			s.goals[cellOf(g.Location)]--
+			s.invalidate(cellOf(g.Location))
+			g.Location = to
+			s.goals[cellOf(to)]++
+			s.invalidate(cellOf(to))
+			return nil
+		}
+	}
+	for _, b := range s.Puzzle.Block {
+		if b.Name == name {
+			s.blocks[cellOf(b.Location)]--
+			s.invalidate(cellOf(b.Location))
+			b.Location = to
+			s.blocks[cellOf(to)]++
+			s.invalidate(cellOf(to))
+			return nil
+		}
+	}
+	for _, sphere := range s.Puzzle.Sphere {
+		if sphere.Name == name {
+			// Walks do not depend on where the sphere starts
+			sphere.Location = to
+			return nil
+		}
+	}
+	for _, p := range s.Puzzle.Portal {
+		if p.Name == name {
+			s.removePortal(p)
+			s.invalidate(cellOf(p.Location))
+			if IsExit(p) {
+				p.Link = PortalLink(to)
+			}
+			p.Location = to
+			s.addPortal(p)
+			s.invalidate(cellOf(to))
+			return nil
+		}
+	}
+	return errors.New("No such element: " + name)
+}
+
+// Apply makes one edit, written as one of:
+//
+//	add <element in the puzzle text format, such as block:b9:box:grey:0,1,0::main:main>
+//	remove <name>
+//	move <name> <x,y,z>
+func (s *IncrementalScorer) Apply(edit string) error {
+	fields := strings.Fields(edit)
+	if len(fields) == 0 {
+		return errors.New("Empty edit")
+	}
+	switch fields[0] {
+	case "add":
+		if len(fields) != 2 {
+			return errors.New("Malformed edit: " + edit)
+		}
+		if err := checkElement(fields[1]); err != nil {
+			return err
+		}
+		p, err := perspectivego.ReadPuzzle(strings.NewReader(fields[1]))
+		if err != nil {
+			return err
+		}
+		for _, g := range p.Goal {
+			s.AddGoal(g)
+		}
+		for _, b := range p.Block {
+			s.AddBlock(b)
+		}
+		for _, sphere := range p.Sphere {
+			s.AddSphere(sphere)
+		}
+		for _, portal := range p.Portal {
+			s.AddPortal(portal)
+		}
+		if len(p.Goal)+len(p.Block)+len(p.Sphere)+len(p.Portal) == 0 {
+			return errors.New("No element: " + fields[1])
+		}
+		return nil
+	case "remove":
+		if len(fields) != 2 {
+			return errors.New("Malformed edit: " + edit)
+		}
+		return s.Remove(fields[1])
+	case "move":
+		if len(fields) != 3 {
+			return errors.New("Malformed edit: " + edit)
+		}
+		location, err := parseLocation(fields[2])
+		if err != nil {
+			return err
+		}
+		return s.Move(fields[1], location)
+	}
+	return errors.New("Unrecognized edit: " + edit)
+}
+
+// elementFields is the number of fields in each kind of element line of the puzzle text format
+var elementFields = map[string]int{
+	"goal":   8,
+	"block":  8,
+	"sphere": 8,
+	"portal": 9,
+}
+
+// checkElement returns an error for an element line which ReadPuzzle would panic or exit on.
+func checkElement(element string) error {
+	parts := strings.Split(element, ":")
+	count, ok := elementFields[parts[0]]
+	if !ok {
+		return errors.New("No element: " + element)
+	}
+	if len(parts) != count {
+		return errors.New("Malformed element: " + element)
+	}
+	if _, err := parseLocation(parts[4]); err != nil {
+		return err
+	}
+	if parts[0] == "portal" {
+		if _, err := parseLocation(parts[5]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseLocation parses an x,y,z location, returning an error where StringToLocation would exit.
+func parseLocation(s string) (*perspectivego.Location, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 3 {
+		return nil, errors.New("Malformed location: " + s)
+	}
+	var coordinates [3]int32
+	for i, p := range parts {
+		c, err := strconv.ParseInt(p, 10, 32)
+		if err != nil {
+			return nil, errors.New("Malformed location: " + s)
+		}
+		coordinates[i] = int32(c)
+	}
+	return locationOf(coordinates), nil
+}
+
+func (s *IncrementalScorer) addPortal(portal *perspectivego.Portal) {
+	c := cellOf(portal.Location)
+	s.portals[c] = append(s.portals[c], portal)
+}
+
+func (s *IncrementalScorer) removePortal(portal *perspectivego.Portal) {
+	c := cellOf(portal.Location)
+	ps := s.portals[c]
+	for i, p := range ps {
+		if p == portal {
+			s.portals[c] = append(ps[:i], ps[i+1:]...)
+			return
+		}
+	}
+}
+
+// portal returns the portal the sphere enters at the given cell, which like ScoreBounds is the last enterable portal there, or nil.
+func (s *IncrementalScorer) portal(c cell) *perspectivego.Portal {
+	ps := s.portals[c]
+	switch len(ps) {
+	case 0:
+		return nil
+	case 1:
+		if IsExit(ps[0]) {
+			return nil
+		}
+		return ps[0]
+	}
+	// Moves can reorder the portals sharing a cell, so find the last in puzzle order
+	for i := len(s.Puzzle.Portal) - 1; i >= 0; i-- {
+		if p := s.Puzzle.Portal[i]; cellOf(p.Location) == c && !IsExit(p) {
+			return p
+		}
+	}
+	return nil
+}
+
+// invalidate forgets every walk which depends on the contents of the given cell.
+func (s *IncrementalScorer) invalidate(c cell) {
+	for key, walk := range s.touches[c] {
+		if s.walks[key] == walk {
+			delete(s.walks, key)
+		}
+		for _, t := range walk.Touched {
+			if s.touches[t][key] == walk {
+				delete(s.touches[t], key)
+			}
+		}
+	}
+	delete(s.touches, c)
+}
+
+func (s *IncrementalScorer) scoreDirections(c cell, portaled bool) (int, int) {
+	min := BAD
+	dir := 2
+	for d := range directions {
+		// Like ScoreDirections, results are shared between arriving with and without having just left a portal
+		id := walkKey{c, d, false}
+		rotations, ok := s.tested[id]
+		if !ok {
+			s.tested[id] = BAD // Set now, update later to avoid loops
+			rotations = s.scoreDirection(walkKey{c, d, portaled})
+			s.tested[id] = rotations
+		}
+		if rotations >= 0 && (rotations < min || min == BAD) {
+			min = rotations
+			dir = d
+		}
+	}
+	return min, dir
+}
+
+func (s *IncrementalScorer) scoreDirection(key walkKey) int {
+	walk, ok := s.walks[key]
+	if !ok {
+		walk = s.walk(key)
+		s.walks[key] = walk
+		for _, t := range walk.Touched {
+			if s.touches[t] == nil {
+				s.touches[t] = make(map[walkKey]*walkResult)
+			}
+			s.touches[t][key] = walk
+		}
+	}
+	for _, v := range walk.Visited {
+		s.visited[v] = true
+	}
+	switch walk.Outcome {
+	case WALK_GOAL:
+		return 0
+	case WALK_REST:
+		r, _ := s.scoreDirections(walk.Rest, walk.Portaled)
+		if r >= 0 {
+			return r + GOOD
+		}
+		return r
+	}
+	return BAD
+}
+
+// walk simulates the sphere like ScoreDirection, up to the point where it would recurse.
+func (s *IncrementalScorer) walk(key walkKey) *walkResult {
+	s.Walks++
+	result := &walkResult{}
+	touched := make(map[cell]bool)
+	touch := func(c cell) {
+		if !touched[c] {
+			touched[c] = true
+			result.Touched = append(result.Touched, c)
+		}
+	}
+	sphere := &perspectivego.Location{
+		X: key.Cell[0],
+		Y: key.Cell[1],
+		Z: key.Cell[2],
+	}
+	direction := directions[key.Direction]
+	portaled := key.Portaled
+	usage := make(map[cell]int)
+	wraps := make(map[walkKey]bool)
+	for {
+		if !s.Bounds.Contains(sphere) {
+			result.Outcome = WALK_OUT
+			return result
+		}
+		c := cellOf(sphere)
+		touch(c)
+		if s.goals[c] > 0 {
+			result.Outcome = WALK_GOAL
+			return result
+		}
+		if !portaled {
+			if p := s.portal(c); p != nil {
+				if usage[c] >= MAX_PORTAL_USES {
+					result.Outcome = WALK_LOOP
+					return result
+				}
+				usage[c]++
+				sphere.X = p.Link.X
+				sphere.Y = p.Link.Y
+				sphere.Z = p.Link.Z
+				if gravity := PortalGravity(p); gravity != nil {
+					direction = gravity
+				}
+				portaled = true
+				result.Visited = append(result.Visited, c, cellOf(sphere))
+				continue
+			}
+		}
+		next, ok, wrapped := s.Bounds.Next(sphere, direction)
+		if ok {
+			touch(cellOf(next))
+		}
+		if !ok || s.blocks[cellOf(next)] > 0 {
+			if ok {
+				result.Visited = append(result.Visited, cellOf(next))
+			}
+			result.Outcome = WALK_REST
+			result.Rest = c
+			result.Portaled = portaled
+			return result
+		}
+		if wrapped {
+			w := walkKey{Cell: cellOf(next), Direction: directionIndex(direction)}
+			if wraps[w] {
+				result.Outcome = WALK_LOOP
+				return result
+			}
+			wraps[w] = true
+		}
+		sphere.X = next.X
+		sphere.Y = next.Y
+		sphere.Z = next.Z
+		portaled = false
+	}
+}
+
+func directionIndex(direction *perspectivego.Location) int {
+	for i, d := range directions {
+		if d == direction {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright 2019 Aletheia Ware LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package perspectiveeditorgo
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestIncrementalScorerMatchesScoreBounds(t *testing.T) {
+	volume := CubeVolume(5)
+	topology := &PortalTopology{GroupSize: 2, Reorient: 0.5}
+	for _, model := range BoundsModels() {
+		bounds, err := volume.Bounds(model)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for seed := int64(0); seed < 20; seed++ {
+			puzzle := generateTestPuzzle(seed, volume, topology, 10, 4)
+			scorer := NewIncrementalScorer(puzzle, bounds)
+			random := rand.New(rand.NewSource(seed))
+			cell := func() string {
+				half := int(volume.Width / 2)
+				return fmt.Sprintf("%d,%d,%d", random.Intn(2*half+1)-half, random.Intn(2*half+1)-half, random.Intn(2*half+1)-half)
+			}
+			for i := 0; i < 40; i++ {
+				var edit string
+				switch random.Intn(3) {
+				case 0:
+					edit = fmt.Sprintf("add block:n%d:box:box:%s:box:box:", i, cell())
+				case 1:
+					if len(puzzle.Block) == 0 {
+						continue
+					}
+					edit = "remove " + puzzle.Block[random.Intn(len(puzzle.Block))].Name
+				case 2:
+					names := []string{puzzle.Goal[0].Name, puzzle.Sphere[0].Name}
+					for _, b := range puzzle.Block {
+						names = append(names, b.Name)
+					}
+					for _, p := range puzzle.Portal {
+						names = append(names, p.Name)
+					}
+					edit = "move " + names[random.Intn(len(names))] + " " + cell()
+				}
+				if err := scorer.Apply(edit); err != nil {
+					t.Fatalf("%s seed %d: %s: %v", model, seed, edit, err)
+				}
+				r1, p1 := ScoreBounds(puzzle, bounds)
+				r2, p2 := scorer.Score()
+				if r1 != r2 || p1 != p2 {
+					t.Fatalf("%s seed %d after %s: expected %d %d, got %d %d", model, seed, edit, r1, p1, r2, p2)
+				}
+			}
+		}
+	}
+}
+
+func TestIncrementalScorerRejectsMalformedEdits(t *testing.T) {
+	puzzle := generateTestPuzzle(0, CubeVolume(5), DefaultPortalTopology(), 4, 2)
+	scorer := NewIncrementalScorer(puzzle, LegacyBounds(5))
+	for _, edit := range []string{
+		"",
+		"move " + puzzle.Block[0].Name + " 1,x,2",
+		"move " + puzzle.Block[0].Name + " 1,2",
+		"add block:b9",
+		"add portal:p9:box:box:0,0,0:box:box:box:box",
+		"add portal:p9:box:box:0,0,0:1,y,1:box:box:box",
+		"add outline:box:box:box:box:box",
+		"spin " + puzzle.Block[0].Name,
+	} {
+		if err := scorer.Apply(edit); err == nil {
+			t.Errorf("%q: expected an error", edit)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+/*
+ * Copyright 2019 Aletheia Ware LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package perspectiveeditorgo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/AletheiaWareLLC/joygo"
+	"github.com/AletheiaWareLLC/perspectivego"
+	"io"
+)
+
+// JSON_VERSION is the version of the JSON schema, incremented whenever a change would break existing readers.
+//
+// A world is encoded as:
+//
+//	{
+//	  "version": 1,
+//	  "name": "...",
+//	  "title": "...",
+//	  "size": 5,
+//	  "foreground_colour": "...",
+//	  "background_colour": "...",
+//	  "shaders": [{"name": "...", "vertex_source": "...", "fragment_source": "...", "attributes": ["..."], "uniforms": ["..."]}],
+//	  "puzzles": [puzzle...]
+//	}
+//
+// A puzzle is encoded as:
+//
+//	{
+//	  "version": 1,
+//	  "description": "...",
+//	  "target": 3,
+//	  "outline": {"mesh": "...", "colour": "...", "texture": "...", "material": "...", "shader": "..."},
+//	  "blocks": [element...],
+//	  "goals": [element...],
+//	  "portals": [element...],
+//	  "spheres": [element...]
+//	}
+//
+// An element is encoded as:
+//
+//	{"name": "...", "mesh": "...", "colour": "...", "texture": "...", "material": "...", "shader": "...", "location": {"x": 0, "y": 0, "z": 0}}
+//
+// Portals also have a "link" location. Shaders are sorted by name, empty strings may be omitted, and puzzles nested in a world omit their version.
+const JSON_VERSION = 1
+
+type JSONWorld struct {
+	Version          int           `json:"version"`
+	Name             string        `json:"name,omitempty"`
+	Title            string        `json:"title,omitempty"`
+	Size             uint32        `json:"size"`
+	ForegroundColour string        `json:"foreground_colour,omitempty"`
+	BackgroundColour string        `json:"background_colour,omitempty"`
+	Shaders          []*JSONShader `json:"shaders,omitempty"`
+	Puzzles          []*JSONPuzzle `json:"puzzles,omitempty"`
+}
+
+type JSONShader struct {
+	Name           string   `json:"name"`
+	VertexSource   string   `json:"vertex_source"`
+	FragmentSource string   `json:"fragment_source"`
+	Attributes     []string `json:"attributes,omitempty"`
+	Uniforms       []string `json:"uniforms,omitempty"`
+}
+
+type JSONPuzzle struct {
+	Version     int            `json:"version,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Target      uint32         `json:"target"`
+	Outline     *JSONOutline   `json:"outline,omitempty"`
+	Blocks      []*JSONElement `json:"blocks,omitempty"`
+	Goals       []*JSONElement `json:"goals,omitempty"`
+	Portals     []*JSONElement `json:"portals,omitempty"`
+	Spheres     []*JSONElement `json:"spheres,omitempty"`
+}
+
+type JSONOutline struct {
+	Mesh     string `json:"mesh,omitempty"`
+	Colour   string `json:"colour,omitempty"`
+	Texture  string `json:"texture,omitempty"`
+	Material string `json:"material,omitempty"`
+	Shader   string `json:"shader,omitempty"`
+}
+
+type JSONElement struct {
+	Name     string        `json:"name"`
+	Mesh     string        `json:"mesh,omitempty"`
+	Colour   string        `json:"colour,omitempty"`
+	Texture  string        `json:"texture,omitempty"`
+	Material string        `json:"material,omitempty"`
+	Shader   string        `json:"shader,omitempty"`
+	Location *JSONLocation `json:"location"`
+	Link     *JSONLocation `json:"link,omitempty"`
+}
+
+type JSONLocation struct {
+	W int32 `json:"w,omitempty"`
+	X int32 `json:"x"`
+	Y int32 `json:"y"`
+	Z int32 `json:"z"`
+}
+
+func ReadWorldJSON(reader io.Reader) (*perspectivego.World, error) {
+	w := &JSONWorld{}
+	if err := json.NewDecoder(reader).Decode(w); err != nil {
+		return nil, err
+	}
+	if w.Version != JSON_VERSION {
+		return nil, fmt.Errorf("Unsupported JSON version: %d", w.Version)
+	}
+	world := &perspectivego.World{
+		Name:             w.Name,
+		Title:            w.Title,
+		Size:             w.Size,
+		ForegroundColour: w.ForegroundColour,
+		BackgroundColour: w.BackgroundColour,
+	}
+	if len(w.Shaders) > 0 {
+		world.Shader = make(map[string]*joygo.Shader, len(w.Shaders))
+		for _, s := range w.Shaders {
+			if _, ok := world.Shader[s.Name]; ok {
+				return nil, errors.New("Duplicate shader: " + s.Name)
+			}
+			world.Shader[s.Name] = &joygo.Shader{
+				Name:           s.Name,
+				VertexSource:   s.VertexSource,
+				FragmentSource: s.FragmentSource,
+				Attributes:     s.Attributes,
+				Uniforms:       s.Uniforms,
+			}
+		}
+	}
+	for _, p := range w.Puzzles {
+		puzzle, err := PuzzleFromJSON(p)
+		if err != nil {
+			return nil, err
+		}
+		world.Puzzle = append(world.Puzzle, puzzle)
+	}
+	return world, nil
+}
+
+func WriteWorldJSON(writer io.Writer, world *perspectivego.World) error {
+	w := &JSONWorld{
+		Version:          JSON_VERSION,
+		Name:             world.Name,
+		Title:            world.Title,
+		Size:             world.Size,
+		ForegroundColour: world.ForegroundColour,
+		BackgroundColour: world.BackgroundColour,
+	}
+	for _, n := range SortedShaderNames(world) {
+		s := world.Shader[n]
+		w.Shaders = append(w.Shaders, &JSONShader{
+			Name:           n,
+			VertexSource:   s.VertexSource,
+			FragmentSource: s.FragmentSource,
+			Attributes:     s.Attributes,
+			Uniforms:       s.Uniforms,
+		})
+	}
+	for _, p := range world.Puzzle {
+		w.Puzzles = append(w.Puzzles, PuzzleToJSON(p))
+	}
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(w)
+}
+
+func ReadPuzzleJSON(reader io.Reader) (*perspectivego.Puzzle, error) {
+	p := &JSONPuzzle{}
+	if err := json.NewDecoder(reader).Decode(p); err != nil {
+		return nil, err
+	}
+	if p.Version != JSON_VERSION {
+		return nil, fmt.Errorf("Unsupported JSON version: %d", p.Version)
+	}
+	return PuzzleFromJSON(p)
+}
+
+func WritePuzzleJSON(writer io.Writer, puzzle *perspectivego.Puzzle) error {
+	p := PuzzleToJSON(puzzle)
+	p.Version = JSON_VERSION
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(p)
+}
+
+func PuzzleToJSON(puzzle *perspectivego.Puzzle) *JSONPuzzle {
+	p := &JSONPuzzle{
+		Description: puzzle.Description,
+		Target:      puzzle.Target,
+	}
+	if o := puzzle.Outline; o != nil {
+		p.Outline = &JSONOutline{
+			Mesh:     o.Mesh,
+			Colour:   o.Colour,
+			Texture:  o.Texture,
+			Material: o.Material,
+			Shader:   o.Shader,
+		}
+	}
+	for _, b := range puzzle.Block {
+		p.Blocks = append(p.Blocks, &JSONElement{
+			Name:     b.Name,
+			Mesh:     b.Mesh,
+			Colour:   b.Colour,
+			Texture:  b.Texture,
+			Material: b.Material,
+			Shader:   b.Shader,
+			Location: LocationToJSON(b.Location),
+		})
+	}
+	for _, g := range puzzle.Goal {
+		p.Goals = append(p.Goals, &JSONElement{
+			Name:     g.Name,
+			Mesh:     g.Mesh,
+			Colour:   g.Colour,
+			Texture:  g.Texture,
+			Material: g.Material,
+			Shader:   g.Shader,
+			Location: LocationToJSON(g.Location),
+		})
+	}
+	for _, o := range puzzle.Portal {
+		p.Portals = append(p.Portals, &JSONElement{
+			Name:     o.Name,
+			Mesh:     o.Mesh,
+			Colour:   o.Colour,
+			Texture:  o.Texture,
+			Material: o.Material,
+			Shader:   o.Shader,
+			Location: LocationToJSON(o.Location),
+			Link:     LocationToJSON(o.Link),
+		})
+	}
+	for _, s := range puzzle.Sphere {
+		p.Spheres = append(p.Spheres, &JSONElement{
+			Name:     s.Name,
+			Mesh:     s.Mesh,
+			Colour:   s.Colour,
+			Texture:  s.Texture,
+			Material: s.Material,
+			Shader:   s.Shader,
+			Location: LocationToJSON(s.Location),
+		})
+	}
+	return p
+}
+
+func PuzzleFromJSON(p *JSONPuzzle) (*perspectivego.Puzzle, error) {
+	puzzle := &perspectivego.Puzzle{
+		Description: p.Description,
+		Target:      p.Target,
+	}
+	if o := p.Outline; o != nil {
+		puzzle.Outline = &perspectivego.Outline{
+			Mesh:     o.Mesh,
+			Colour:   o.Colour,
+			Texture:  o.Texture,
+			Material: o.Material,
+			Shader:   o.Shader,
+		}
+	}
+	for _, e := range p.Blocks {
+		if e.Location == nil {
+			return nil, errors.New("Missing block location: " + e.Name)
+		}
+		puzzle.Block = append(puzzle.Block, &perspectivego.Block{
+			Name:     e.Name,
+			Mesh:     e.Mesh,
+			Colour:   e.Colour,
+			Location: LocationFromJSON(e.Location),
+			Texture:  e.Texture,
+			Material: e.Material,
+			Shader:   e.Shader,
+		})
+	}
+	for _, e := range p.Goals {
+		if e.Location == nil {
+			return nil, errors.New("Missing goal location: " + e.Name)
+		}
+		puzzle.Goal = append(puzzle.Goal, &perspectivego.Goal{
+			Name:     e.Name,
+			Mesh:     e.Mesh,
+			Colour:   e.Colour,
+			Location: LocationFromJSON(e.Location),
+			Texture:  e.Texture,
+			Material: e.Material,
+			Shader:   e.Shader,
+		})
+	}
+	for _, e := range p.Portals {
+		if e.Location == nil {
+			return nil, errors.New("Missing portal location: " + e.Name)
+		}
+		if e.Link == nil {
+			return nil, errors.New("Missing portal link: " + e.Name)
+		}
+		puzzle.Portal = append(puzzle.Portal, &perspectivego.Portal{
+			Name:     e.Name,
+			Mesh:     e.Mesh,
+			Colour:   e.Colour,
+			Location: LocationFromJSON(e.Location),
+			Link:     LocationFromJSON(e.Link),
+			Texture:  e.Texture,
+			Material: e.Material,
+			Shader:   e.Shader,
+		})
+	}
+	for _, e := range p.Spheres {
+		if e.Location == nil {
+			return nil, errors.New("Missing sphere location: " + e.Name)
+		}
+		puzzle.Sphere = append(puzzle.Sphere, &perspectivego.Sphere{
+			Name:     e.Name,
+			Mesh:     e.Mesh,
+			Colour:   e.Colour,
+			Location: LocationFromJSON(e.Location),
+			Texture:  e.Texture,
+			Material: e.Material,
+			Shader:   e.Shader,
+		})
+	}
+	return puzzle, nil
+}
+
+func LocationToJSON(l *perspectivego.Location) *JSONLocation {
+	if l == nil {
+		return nil
+	}
+	return &JSONLocation{
+		W: l.W,
+		X: l.X,
+		Y: l.Y,
+		Z: l.Z,
+	}
+}
+
+func LocationFromJSON(l *JSONLocation) *perspectivego.Location {
+	return &perspectivego.Location{
+		W: l.W,
+		X: l.X,
+		Y: l.Y,
+		Z: l.Z,
+	}
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright 2019 Aletheia Ware LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package perspectiveeditorgo
+
+import (
+	"errors"
+	"fmt"
+	"github.com/AletheiaWareLLC/joygo"
+	"github.com/AletheiaWareLLC/perspectivego"
+	"github.com/golang/protobuf/proto"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MergeWorlds combines the puzzles and shaders of the given worlds, in order, into a new world with the name, title, size and colours of the first.
+// Shaders with the same name must be identical, and puzzles with the same canonical content as an earlier puzzle are skipped and returned as duplicates.
+func MergeWorlds(worlds []*perspectivego.World) (*perspectivego.World, []string, error) {
+	if len(worlds) == 0 {
+		return nil, nil, errors.New("No worlds to merge")
+	}
+	first := worlds[0]
+	merged := &perspectivego.World{
+		Name:             first.Name,
+		Title:            first.Title,
+		Size:             first.Size,
+		ForegroundColour: first.ForegroundColour,
+		BackgroundColour: first.BackgroundColour,
+	}
+	origins := make(map[string]int)
+	puzzles := make(map[string]string)
+	var duplicates []string
+	for w, world := range worlds {
+		if world.Size != merged.Size {
+			return nil, nil, fmt.Errorf("World %d has size %d, expected %d", w, world.Size, merged.Size)
+		}
+		for _, n := range SortedShaderNames(world) {
+			s := world.Shader[n]
+			if existing, ok := merged.Shader[n]; ok {
+				if !proto.Equal(existing, s) {
+					return nil, nil, fmt.Errorf("Shader conflict: %s differs between world %d and world %d", n, origins[n], w)
+				}
+				continue
+			}
+			if merged.Shader == nil {
+				merged.Shader = make(map[string]*joygo.Shader)
+			}
+			merged.Shader[n] = proto.Clone(s).(*joygo.Shader)
+			origins[n] = w
+		}
+		for p, puzzle := range world.Puzzle {
+			path := fmt.Sprintf("world[%d].puzzle[%d]", w, p)
+			c := CanonicalPuzzle(puzzle)
+			if original, ok := puzzles[c]; ok {
+				duplicates = append(duplicates, path+" duplicates "+original)
+				continue
+			}
+			puzzles[c] = path
+			merged.Puzzle = append(merged.Puzzle, proto.Clone(puzzle).(*perspectivego.Puzzle))
+		}
+	}
+	return merged, duplicates, nil
+}
+
+// SplitWorld returns a new world with the puzzles accepted by the filter and only the shaders those puzzles use.
+func SplitWorld(world *perspectivego.World, filter func(int, *perspectivego.Puzzle) bool) *perspectivego.World {
+	split := &perspectivego.World{
+		Name:             world.Name,
+		Title:            world.Title,
+		Size:             world.Size,
+		ForegroundColour: world.ForegroundColour,
+		BackgroundColour: world.BackgroundColour,
+	}
+	for i, p := range world.Puzzle {
+		if !filter(i, p) {
+			continue
+		}
+		split.Puzzle = append(split.Puzzle, proto.Clone(p).(*perspectivego.Puzzle))
+		for _, n := range PuzzleShaders(p) {
+			s, ok := world.Shader[n]
+			if !ok {
+				continue
+			}
+			if split.Shader == nil {
+				split.Shader = make(map[string]*joygo.Shader)
+			}
+			split.Shader[n] = proto.Clone(s).(*joygo.Shader)
+		}
+	}
+	return split
+}
+
+// PuzzleShaders returns the sorted names of the shaders used by the puzzle's outline and elements.
+func PuzzleShaders(puzzle *perspectivego.Puzzle) []string {
+	used := make(map[string]bool)
+	if puzzle.Outline != nil {
+		used[puzzle.Outline.Shader] = true
+	}
+	for _, b := range puzzle.Block {
+		used[b.Shader] = true
+	}
+	for _, g := range puzzle.Goal {
+		used[g.Shader] = true
+	}
+	for _, p := range puzzle.Portal {
+		used[p.Shader] = true
+	}
+	for _, s := range puzzle.Sphere {
+		used[s.Shader] = true
+	}
+	delete(used, "")
+	var names []string
+	for n := range used {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseRanges parses a comma separated list of indices and inclusive ranges, such as 0-4,7,9-, into a function reporting whether an index is included.
+func ParseRanges(s string) (func(int) bool, error) {
+	type span struct {
+		from, to int
+	}
+	var spans []span
+	for _, part := range strings.Split(s, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		from, err := strconv.Atoi(bounds[0])
+		if err != nil || from < 0 {
+			return nil, errors.New("Malformed range: " + part)
+		}
+		to := from
+		if len(bounds) == 2 {
+			if bounds[1] == "" {
+				to = -1
+			} else {
+				to, err = strconv.Atoi(bounds[1])
+				if err != nil || to < from {
+					return nil, errors.New("Malformed range: " + part)
+				}
+			}
+		}
+		spans = append(spans, span{from, to})
+	}
+	return func(i int) bool {
+		for _, s := range spans {
+			if i >= s.from && (s.to < 0 || i <= s.to) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
@@ -0,0 +1,257 @@
+/*
+ * Copyright 2019 Aletheia Ware LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package perspectiveeditorgo
+
+import (
+	"errors"
+	"fmt"
+	"github.com/AletheiaWareLLC/perspectivego"
+)
+
+const (
+	// SCORER_GRAVITY scores like Score, using a GridScorer, where each change between the six gravity directions is one rotation
+	SCORER_GRAVITY = "gravity"
+	// SCORER_QUARTER_TURN scores with ScoreQuarterTurns, where the world is turned a quarter at a time through the 24 cube orientations
+	SCORER_QUARTER_TURN = "quarter-turn"
+)
+
+// Orientation is a cube rotation, mapping the camera's axes onto the world's so that column i is the world direction of camera axis i.
+type Orientation [3][3]int32
+
+var (
+	identity = Orientation{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+	// quarterTurns rotate a quarter turn either way about the camera's X, Y and Z axes
+	quarterTurns = []Orientation{
+		{{1, 0, 0}, {0, 0, -1}, {0, 1, 0}},
+		{{1, 0, 0}, {0, 0, 1}, {0, -1, 0}},
+		{{0, 0, 1}, {0, 1, 0}, {-1, 0, 0}},
+		{{0, 0, -1}, {0, 1, 0}, {1, 0, 0}},
+		{{0, -1, 0}, {1, 0, 0}, {0, 0, 1}},
+		{{0, 1, 0}, {-1, 0, 0}, {0, 0, 1}},
+	}
+	// orientations holds the 24 cube rotations, with the identity first
+	orientations []Orientation
+	// turns[o][t] is the orientation reached from orientations[o] by quarterTurns[t]
+	turns [][]int
+	// turnDistance[a][b] is the fewest quarter turns from orientations[a] to orientations[b]
+	turnDistance [][]int
+)
+
+func init() {
+	index := map[Orientation]int{identity: 0}
+	orientations = []Orientation{identity}
+	for i := 0; i < len(orientations); i++ {
+		turns = append(turns, make([]int, len(quarterTurns)))
+		for t, q := range quarterTurns {
+			o := orientations[i].Multiply(q)
+			j, ok := index[o]
+			if !ok {
+				j = len(orientations)
+				index[o] = j
+				orientations = append(orientations, o)
+			}
+			turns[i][t] = j
+		}
+	}
+	for a := range orientations {
+		distance := make([]int, len(orientations))
+		for i := range distance {
+			distance[i] = -1
+		}
+		distance[a] = 0
+		queue := []int{a}
+		for len(queue) > 0 {
+			o := queue[0]
+			queue = queue[1:]
+			for _, next := range turns[o] {
+				if distance[next] < 0 {
+					distance[next] = distance[o] + 1
+					queue = append(queue, next)
+				}
+			}
+		}
+		turnDistance = append(turnDistance, distance)
+	}
+}
+
+func (o Orientation) Multiply(q Orientation) Orientation {
+	var r Orientation
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				r[i][j] += o[i][k] * q[k][j]
+			}
+		}
+	}
+	return r
+}
+
+// Gravity returns the world direction of the camera's down.
+func (o Orientation) Gravity() *perspectivego.Location {
+	g := &perspectivego.Location{
+		X: -o[0][1],
+		Y: -o[1][1],
+		Z: -o[2][1],
+	}
+	for _, d := range directions {
+		if d.X == g.X && d.Y == g.Y && d.Z == g.Z {
+			return d
+		}
+	}
+	return g
+}
+
+// Orientations returns the 24 cube rotations, with the identity first.
+func Orientations() []Orientation {
+	return append([]Orientation{}, orientations...)
+}
+
+// QuarterTurns returns the fewest quarter turns needed to turn between two of the 24 orientations.
+func QuarterTurns(from, to Orientation) int {
+	a, b := -1, -1
+	for i, o := range orientations {
+		if o == from {
+			a = i
+		}
+		if o == to {
+			b = i
+		}
+	}
+	if a < 0 || b < 0 {
+		return BAD
+	}
+	return turnDistance[a][b]
+}
+
+// nearestOrientation returns the orientation with the given gravity which is fewest quarter turns from the given orientation.
+func nearestOrientation(from int, gravity *perspectivego.Location) int {
+	best := -1
+	for i, o := range orientations {
+		g := o.Gravity()
+		if g.X != gravity.X || g.Y != gravity.Y || g.Z != gravity.Z {
+			continue
+		}
+		if best < 0 || turnDistance[from][i] < turnDistance[from][best] {
+			best = i
+		}
+	}
+	return best
+}
+
+// ScoreQuarterTurns is like Score but models the camera's orientation, so rotations are counted in quarter turns of the world
+// about the camera's axes. Turning about the vertical axis changes no gravity, a quarter turn about either other axis tips gravity sideways,
+// and flipping gravity takes two turns with the sphere moving under the intermediate gravity. A portal which reorients gravity
+// turns the camera to the nearest orientation with that gravity at no cost. Rotations is the fewest quarter turns to reach a goal, found by
+// breadth-first search, and Penalty the number of blocks and portals the sphere can never touch.
+func ScoreQuarterTurns(puzzle *perspectivego.Puzzle, bounds *Bounds) (int, int) {
+	if len(puzzle.Sphere) == 0 {
+		return BAD, len(puzzle.Block) + len(puzzle.Portal)
+	}
+	simulation := NewBoundedSimulation(puzzle, bounds)
+	portals := make(map[string]*perspectivego.Portal, len(puzzle.Portal))
+	for _, p := range puzzle.Portal {
+		portals[p.Name] = p
+	}
+	visited := make(map[string]bool)
+	type state struct {
+		location    *perspectivego.Location
+		orientation int
+		portaled    bool
+	}
+	// layers[r] holds the resting states first reached with r rotations, and best the fewest rotations each state was reached with
+	var layers [][]*state
+	best := make(map[string]int)
+	rotations := BAD
+	key := func(location *perspectivego.Location, orientation int, portaled bool) string {
+		return fmt.Sprintf("%s%d%t", location.String(), orientation, portaled)
+	}
+	walk := func(location *perspectivego.Location, orientation, cost int, portaled bool) {
+		gravity := orientations[orientation].Gravity()
+		rest, direction, portaled, traversed, outcome := simulation.Walk(location, gravity, portaled)
+		for _, n := range traversed {
+			p := portals[n]
+			visited[p.Location.String()] = true
+			visited[PortalDestination(p).String()] = true
+		}
+		switch outcome {
+		case WALK_GOAL:
+			if rotations == BAD || cost < rotations {
+				rotations = cost
+			}
+		case WALK_REST:
+			if direction != gravity {
+				orientation = nearestOrientation(orientation, direction)
+			}
+			visited[(&perspectivego.Location{
+				X: rest.X + direction.X,
+				Y: rest.Y + direction.Y,
+				Z: rest.Z + direction.Z,
+			}).String()] = true
+			k := key(rest, orientation, portaled)
+			if r, ok := best[k]; ok && r <= cost {
+				return
+			}
+			best[k] = cost
+			for len(layers) <= cost {
+				layers = append(layers, nil)
+			}
+			layers[cost] = append(layers[cost], &state{rest, orientation, portaled})
+		}
+	}
+	// Like Score, the world can be turned before the sphere is released, at the cost of the turns
+	start := puzzle.Sphere[0].Location
+	for o := range orientations {
+		walk(start, o, turnDistance[0][o], false)
+	}
+	// Search every reachable state, not just until the first goal, so the penalty covers everything the sphere can touch
+	for r := 0; r < len(layers); r++ {
+		for _, current := range layers[r] {
+			if best[key(current.location, current.orientation, current.portaled)] < r {
+				continue
+			}
+			for _, next := range turns[current.orientation] {
+				walk(current.location, next, r+1, current.portaled)
+			}
+		}
+	}
+	penalty := 0
+	for _, b := range puzzle.Block {
+		if !visited[b.Location.String()] {
+			penalty++
+		}
+	}
+	for _, p := range puzzle.Portal {
+		if !visited[p.Location.String()] {
+			penalty++
+		}
+	}
+	return rotations, penalty
+}
+
+// NewScorer returns a function scoring puzzles within the given bounds by the given mode.
+// The gravity mode reuses one GridScorer, so the function is not safe for concurrent use.
+func NewScorer(mode string, bounds *Bounds) (func(*perspectivego.Puzzle) (int, int), error) {
+	switch mode {
+	case "", SCORER_GRAVITY:
+		return NewGridScorer(bounds).Score, nil
+	case SCORER_QUARTER_TURN:
+		return func(puzzle *perspectivego.Puzzle) (int, int) {
+			return ScoreQuarterTurns(puzzle, bounds)
+		}, nil
+	}
+	return nil, errors.New("Unrecognized scorer: " + mode)
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright 2019 Aletheia Ware LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package perspectiveeditorgo
+
+import (
+	"github.com/AletheiaWareLLC/perspectivego"
+	"testing"
+)
+
+func TestOrientations(t *testing.T) {
+	all := Orientations()
+	if len(all) != 24 {
+		t.Fatalf("Expected 24 orientations, got %d", len(all))
+	}
+	if all[0] != identity || all[0].Gravity() != down {
+		t.Fatal("Expected the identity first, with gravity down")
+	}
+}
+
+func TestQuarterTurnsBetweenGravities(t *testing.T) {
+	// The fewest quarter turns from the identity to each gravity: none for down, one for each side, and two to flip
+	expected := map[*perspectivego.Location]int{
+		left:     1,
+		right:    1,
+		down:     0,
+		up:       2,
+		backward: 1,
+		foreward: 1,
+	}
+	for _, a := range Orientations() {
+		fewest := make(map[*perspectivego.Location]int)
+		for _, b := range Orientations() {
+			g := b.Gravity()
+			if q, ok := fewest[g]; !ok || QuarterTurns(a, b) < q {
+				fewest[g] = QuarterTurns(a, b)
+			}
+		}
+		for _, d := range directions {
+			var opposite *perspectivego.Location
+			for _, o := range directions {
+				if o.X == -d.X && o.Y == -d.Y && o.Z == -d.Z {
+					opposite = o
+				}
+			}
+			if a.Gravity() == d && fewest[opposite] != 2 {
+				t.Errorf("Expected 2 quarter turns from %s to %s, got %d", DirectionName(d), DirectionName(opposite), fewest[opposite])
+			}
+		}
+		if a == identity {
+			for d, q := range expected {
+				if fewest[d] != q {
+					t.Errorf("Expected %d quarter turns to %s, got %d", q, DirectionName(d), fewest[d])
+				}
+			}
+		}
+	}
+}
+
+func testElements(sphere, goal *perspectivego.Location, blocks ...*perspectivego.Location) *perspectivego.Puzzle {
+	puzzle := &perspectivego.Puzzle{
+		Sphere: []*perspectivego.Sphere{{Name: "s0", Location: sphere}},
+		Goal:   []*perspectivego.Goal{{Name: "g0", Location: goal}},
+	}
+	for _, b := range blocks {
+		puzzle.Block = append(puzzle.Block, &perspectivego.Block{Name: "b", Location: b})
+	}
+	return puzzle
+}
+
+func TestScoreQuarterTurnsStraightDown(t *testing.T) {
+	puzzle := testElements(&perspectivego.Location{Y: 2}, &perspectivego.Location{Y: -2})
+	bounds := LegacyBounds(2)
+	if r, _ := ScoreQuarterTurns(puzzle, bounds); r != 0 {
+		t.Fatalf("Expected 0 quarter turns, got %d", r)
+	}
+	if r, _ := ScoreBounds(puzzle, bounds); r != 0 {
+		t.Fatalf("Expected 0 rotations, got %d", r)
+	}
+}
+
+func TestScoreQuarterTurnsFlip(t *testing.T) {
+	// The block stops the sphere falling, so it must fall up to the goal
+	puzzle := testElements(&perspectivego.Location{}, &perspectivego.Location{Y: 2}, &perspectivego.Location{Y: -1})
+	bounds := LegacyBounds(2)
+	if r, _ := ScoreQuarterTurns(puzzle, bounds); r != 2 {
+		t.Fatalf("Expected 2 quarter turns, got %d", r)
+	}
+	if r, _ := ScoreBounds(puzzle, bounds); r != 1 {
+		t.Fatalf("Expected 1 rotation, got %d", r)
+	}
+}
+
+func TestNewScorer(t *testing.T) {
+	bounds := LegacyBounds(5)
+	for mode, expected := range map[string]func(*perspectivego.Puzzle, *Bounds) (int, int){
+		"":                  ScoreBounds,
+		SCORER_GRAVITY:      ScoreBounds,
+		SCORER_QUARTER_TURN: ScoreQuarterTurns,
+	} {
+		scorer, err := NewScorer(mode, bounds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for seed := int64(0); seed < 50; seed++ {
+			puzzle := generateTestPuzzle(seed, CubeVolume(5), DefaultPortalTopology(), 8, 2)
+			r1, p1 := expected(puzzle, bounds)
+			r2, p2 := scorer(puzzle)
+			if r1 != r2 || p1 != p2 {
+				t.Fatalf("%q seed %d: expected %d %d, got %d %d", mode, seed, r1, p1, r2, p2)
+			}
+		}
+	}
+	if _, err := NewScorer("sideways", bounds); err == nil {
+		t.Fatal("Expected an error for an unrecognized scorer")
+	}
+}
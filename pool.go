@@ -0,0 +1,239 @@
+/*
+ * Copyright 2019 Aletheia Ware LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package perspectiveeditorgo
+
+import (
+	"github.com/AletheiaWareLLC/perspectivego"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const DEFAULT_POOL_SIZE = 10
+
+// Metrics measures a candidate puzzle.
+// Higher scores are better, all other metrics are better when lower.
+type Metrics struct {
+	Score    int
+	Penalty  int
+	Elements int
+	Portals  int
+	// Extent is the volume of the bounding box of all elements
+	Extent int
+}
+
+func NewMetrics(puzzle *perspectivego.Puzzle, score, penalty int) *Metrics {
+	return &Metrics{
+		Score:    score,
+		Penalty:  penalty,
+		Elements: len(puzzle.Block) + len(puzzle.Goal) + len(puzzle.Portal) + len(puzzle.Sphere),
+		Portals:  len(puzzle.Portal),
+		Extent:   Extent(puzzle),
+	}
+}
+
+func Extent(puzzle *perspectivego.Puzzle) int {
+	var locations []*perspectivego.Location
+	for _, b := range puzzle.Block {
+		locations = append(locations, b.Location)
+	}
+	for _, g := range puzzle.Goal {
+		locations = append(locations, g.Location)
+	}
+	for _, p := range puzzle.Portal {
+		locations = append(locations, p.Location)
+	}
+	for _, s := range puzzle.Sphere {
+		locations = append(locations, s.Location)
+	}
+	if len(locations) == 0 {
+		return 0
+	}
+	min := *locations[0]
+	max := *locations[0]
+	for _, l := range locations[1:] {
+		if l.X < min.X {
+			min.X = l.X
+		}
+		if l.Y < min.Y {
+			min.Y = l.Y
+		}
+		if l.Z < min.Z {
+			min.Z = l.Z
+		}
+		if l.X > max.X {
+			max.X = l.X
+		}
+		if l.Y > max.Y {
+			max.Y = l.Y
+		}
+		if l.Z > max.Z {
+			max.Z = l.Z
+		}
+	}
+	return int(max.X-min.X+1) * int(max.Y-min.Y+1) * int(max.Z-min.Z+1)
+}
+
+// Dominates returns true if m is at least as good as o in every metric, and better in at least one.
+func (m *Metrics) Dominates(o *Metrics) bool {
+	if m.Score < o.Score || m.Penalty > o.Penalty || m.Elements > o.Elements || m.Portals > o.Portals || m.Extent > o.Extent {
+		return false
+	}
+	return *m != *o
+}
+
+// Less orders metrics of the same score from best to worst.
+func (m *Metrics) Less(o *Metrics) bool {
+	if m.Penalty != o.Penalty {
+		return m.Penalty < o.Penalty
+	}
+	if m.Elements != o.Elements {
+		return m.Elements < o.Elements
+	}
+	if m.Portals != o.Portals {
+		return m.Portals < o.Portals
+	}
+	return m.Extent < o.Extent
+}
+
+type Candidate struct {
+	Name    string
+	Puzzle  *perspectivego.Puzzle
+	Metrics *Metrics
+}
+
+// CandidateName returns the file name of a candidate with the given score generated from the given seed.
+func CandidateName(score int, seed int64) string {
+	return "puzzle" + strconv.Itoa(score) + "-" + strconv.FormatInt(seed, 10) + ".txt"
+}
+
+// Pool holds, for each score, the Pareto front of candidates over the remaining metrics.
+// Candidates only compete with others of the same score so a world can be assembled with one puzzle per score.
+type Pool struct {
+	// MaxPerScore limits the size of each front, evicting the worst candidates
+	MaxPerScore int
+	Candidates  map[int][]*Candidate
+}
+
+func NewPool(max int) *Pool {
+	return &Pool{
+		MaxPerScore: max,
+		Candidates:  make(map[int][]*Candidate),
+	}
+}
+
+// Add adds the candidate to the pool if it is not dominated, and returns whether it was added along with any candidates it displaced.
+func (p *Pool) Add(candidate *Candidate) (bool, []*Candidate) {
+	score := candidate.Metrics.Score
+	var front []*Candidate
+	var removed []*Candidate
+	for _, c := range p.Candidates[score] {
+		if *c.Metrics == *candidate.Metrics || c.Metrics.Dominates(candidate.Metrics) {
+			return false, nil
+		}
+		if candidate.Metrics.Dominates(c.Metrics) {
+			removed = append(removed, c)
+		} else {
+			front = append(front, c)
+		}
+	}
+	front = append(front, candidate)
+	sort.SliceStable(front, func(i, j int) bool {
+		return front[i].Metrics.Less(front[j].Metrics)
+	})
+	if p.MaxPerScore > 0 && len(front) > p.MaxPerScore {
+		evicted := front[p.MaxPerScore:]
+		front = front[:p.MaxPerScore]
+		for _, c := range evicted {
+			if c == candidate {
+				return false, nil
+			}
+		}
+		removed = append(removed, evicted...)
+	}
+	p.Candidates[score] = front
+	return true, removed
+}
+
+func (p *Pool) Scores() []int {
+	scores := make([]int, 0, len(p.Candidates))
+	for s := range p.Candidates {
+		scores = append(scores, s)
+	}
+	sort.Ints(scores)
+	return scores
+}
+
+// Best returns the best candidate with the given score, or nil if there are none.
+func (p *Pool) Best(score int) *Candidate {
+	front := p.Candidates[score]
+	if len(front) == 0 {
+		return nil
+	}
+	return front[0]
+}
+
+func (p *Pool) Get(name string) *Candidate {
+	for _, front := range p.Candidates {
+		for _, c := range front {
+			if c.Name == name {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// ReadPool reads every puzzle in the given directory and scores it with the given scorer, which should be the one the pool was filled with.
+// It also returns the candidates which were read but are not in the pool, because they are dominated or beyond the max, so their files can be removed.
+func ReadPool(directory string, scorer func(*perspectivego.Puzzle) (int, int), max int) (*Pool, []*Candidate, error) {
+	pool := NewPool(max)
+	files, err := ioutil.ReadDir(directory)
+	if err != nil {
+		return nil, nil, err
+	}
+	var dropped []*Candidate
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".txt") {
+			continue
+		}
+		file, err := os.Open(path.Join(directory, f.Name()))
+		if err != nil {
+			return nil, nil, err
+		}
+		puzzle, err := perspectivego.ReadPuzzle(file)
+		file.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+		r, p := scorer(puzzle)
+		candidate := &Candidate{
+			Name:    f.Name(),
+			Puzzle:  puzzle,
+			Metrics: NewMetrics(puzzle, r, p),
+		}
+		added, removed := pool.Add(candidate)
+		if !added {
+			dropped = append(dropped, candidate)
+		}
+		dropped = append(dropped, removed...)
+	}
+	return pool, dropped, nil
+}
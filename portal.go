@@ -0,0 +1,165 @@
+/*
+ * Copyright 2019 Aletheia Ware LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package perspectiveeditorgo
+
+import (
+	"errors"
+	"fmt"
+	"github.com/AletheiaWareLLC/perspectivego"
+	"math/rand"
+	"strings"
+)
+
+// Portals are linked by their Link location, which allows topologies beyond pairs:
+//
+//   - A pair links two portals to each other.
+//   - A cycle links each portal in a group of three or more to the next, and the last back to the first.
+//   - A one-way portal links to an exit, which is a portal linked to its own location and cannot be entered.
+//
+// A portal which changes the gravity of the sphere leaving it has the name of the new direction after PORTAL_GRAVITY_SEPARATOR
+// at the end of its own name, such as p3@left, as perspectivego has no field for it.
+//
+// The game plays neither exits nor changes of gravity, so CheckGamePuzzle refuses puzzles using them, which the editor's scorers
+// and solvers alone understand, to keep them out of worlds.
+const (
+	PORTAL_GRAVITY_SEPARATOR = "@"
+	// MAX_PORTAL_USES limits how many times a walk can pass through each portal, to stop infinite portal loops
+	MAX_PORTAL_USES = 6
+)
+
+// PortalTopology describes how Generate links portals.
+type PortalTopology struct {
+	// GroupSize is the number of portals linked in each cycle, 2 gives pairs
+	GroupSize int
+	// OneWay makes each group a chain ending in an exit instead of a cycle
+	OneWay bool
+	// Reorient is the probability, from 0 to 1, that a portal changes gravity to a random direction
+	Reorient float64
+}
+
+// DefaultPortalTopology links portals in pairs which keep gravity.
+func DefaultPortalTopology() *PortalTopology {
+	return &PortalTopology{
+		GroupSize: 2,
+	}
+}
+
+func (t *PortalTopology) Validate(portalCount int) error {
+	if t.GroupSize < 2 {
+		return errors.New("Portal group size must be at least 2")
+	}
+	if portalCount%t.GroupSize != 0 {
+		return errors.New("Portal count must be a multiple of the portal group size")
+	}
+	if t.Reorient < 0 || t.Reorient > 1 {
+		return errors.New("Portal reorient probability must be between 0 and 1")
+	}
+	return nil
+}
+
+// LinkPortals links consecutive groups of portals according to the topology.
+// The random number generator is only used when Reorient is non-zero, so pairs which keep gravity are generated exactly as before.
+func LinkPortals(portals []*perspectivego.Portal, topology *PortalTopology) {
+	for start := 0; start+topology.GroupSize <= len(portals); start += topology.GroupSize {
+		group := portals[start : start+topology.GroupSize]
+		for i, p := range group {
+			var target *perspectivego.Location
+			if i+1 < len(group) {
+				target = group[i+1].Location
+			} else if topology.OneWay {
+				target = p.Location
+			} else {
+				target = group[0].Location
+			}
+			var gravity *perspectivego.Location
+			if target != p.Location && topology.Reorient > 0 && rand.Float64() < topology.Reorient {
+				gravity = directions[rand.Intn(len(directions))]
+			}
+			p.Link = PortalLink(target)
+			SetPortalGravity(p, gravity)
+		}
+	}
+}
+
+// PortalLink returns a link to the given location.
+func PortalLink(location *perspectivego.Location) *perspectivego.Location {
+	return &perspectivego.Location{
+		X: location.X,
+		Y: location.Y,
+		Z: location.Z,
+	}
+}
+
+// PortalDestination returns the location the portal leads to, without its gravity.
+func PortalDestination(portal *perspectivego.Portal) *perspectivego.Location {
+	return &perspectivego.Location{
+		X: portal.Link.X,
+		Y: portal.Link.Y,
+		Z: portal.Link.Z,
+	}
+}
+
+// PortalGravity returns the direction of gravity on leaving the portal, or nil if the portal keeps gravity.
+func PortalGravity(portal *perspectivego.Portal) *perspectivego.Location {
+	i := strings.LastIndex(portal.Name, PORTAL_GRAVITY_SEPARATOR)
+	if i < 0 {
+		return nil
+	}
+	gravity, err := ParseDirection(portal.Name[i+len(PORTAL_GRAVITY_SEPARATOR):])
+	if err != nil {
+		return nil
+	}
+	return gravity
+}
+
+// SetPortalGravity names the direction of gravity on leaving the portal, or removes it if the gravity is nil.
+func SetPortalGravity(portal *perspectivego.Portal, gravity *perspectivego.Location) {
+	if PortalGravity(portal) != nil {
+		portal.Name = portal.Name[:strings.LastIndex(portal.Name, PORTAL_GRAVITY_SEPARATOR)]
+	}
+	if gravity != nil {
+		portal.Name += PORTAL_GRAVITY_SEPARATOR + DirectionName(gravity)
+	}
+}
+
+// CheckGamePuzzle returns an error if any portal of the puzzle is an exit or reorients gravity, which only the editor understands.
+func CheckGamePuzzle(puzzle *perspectivego.Puzzle) error {
+	for _, p := range puzzle.Portal {
+		if IsExit(p) {
+			return errors.New("Portal " + p.Name + " is an exit, which the game cannot play")
+		}
+		if PortalGravity(p) != nil {
+			return errors.New("Portal " + p.Name + " reorients gravity, which the game cannot play")
+		}
+	}
+	return nil
+}
+
+// CheckGameWorld returns an error if any puzzle of the world fails CheckGamePuzzle.
+func CheckGameWorld(world *perspectivego.World) error {
+	for i, p := range world.Puzzle {
+		if err := CheckGamePuzzle(p); err != nil {
+			return fmt.Errorf("Puzzle %d: %s", i+1, err)
+		}
+	}
+	return nil
+}
+
+// IsExit returns true if the portal is linked to its own location, and so can be arrived at but not entered.
+func IsExit(portal *perspectivego.Portal) bool {
+	return portal.Link == nil || (portal.Link.X == portal.Location.X && portal.Link.Y == portal.Location.Y && portal.Link.Z == portal.Location.Z)
+}
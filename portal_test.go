@@ -0,0 +1,62 @@
+/*
+ * Copyright 2019 Aletheia Ware LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package perspectiveeditorgo
+
+import (
+	"github.com/AletheiaWareLLC/perspectivego"
+	"testing"
+)
+
+func TestPortalGravityKeepsLinks(t *testing.T) {
+	topology := &PortalTopology{GroupSize: 2, Reorient: 1}
+	reoriented := 0
+	for seed := int64(0); seed < 20; seed++ {
+		puzzle := generateTestPuzzle(seed, CubeVolume(5), topology, 4, 4)
+		for _, p := range puzzle.Portal {
+			if p.Link.W != 0 {
+				t.Fatalf("Seed %d: portal %s link has W %d", seed, p.Name, p.Link.W)
+			}
+			if PortalGravity(p) != nil {
+				reoriented++
+			}
+		}
+		if PortalGravity(puzzle.Portal[0]) != nil {
+			if err := CheckGamePuzzle(puzzle); err == nil {
+				t.Fatalf("Seed %d: expected reorienting portal to be refused", seed)
+			}
+		}
+	}
+	if reoriented == 0 {
+		t.Fatal("No portal changed gravity")
+	}
+}
+
+func TestSetPortalGravity(t *testing.T) {
+	portal := &perspectivego.Portal{Name: "p0"}
+	SetPortalGravity(portal, left)
+	if portal.Name != "p0@left" || PortalGravity(portal) != left {
+		t.Fatal("Expected p0@left, got", portal.Name)
+	}
+	SetPortalGravity(portal, foreward)
+	if portal.Name != "p0@forward" || PortalGravity(portal) != foreward {
+		t.Fatal("Expected p0@forward, got", portal.Name)
+	}
+	SetPortalGravity(portal, nil)
+	if portal.Name != "p0" || PortalGravity(portal) != nil {
+		t.Fatal("Expected p0, got", portal.Name)
+	}
+}
@@ -0,0 +1,198 @@
+/*
+ * Copyright 2019 Aletheia Ware LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package perspectiveeditorgo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	PROGRESS_TERMINAL = "terminal"
+	PROGRESS_JSON     = "json"
+)
+
+// Progress tracks the statistics of a generation run and periodically reports them.
+type Progress struct {
+	Writer   ProgressWriter
+	Interval time.Duration
+	Start    time.Time
+	// Total is the iteration at which the run ends, used to estimate the time remaining
+	Total int
+	// Deadline is the time at which the run ends, if it is limited by wall-clock time
+	Deadline  time.Time
+	Iteration int
+	Accepted  int
+	Best      int
+	// Penalties maps each penalty to the number of solvable puzzles generated with it
+	Penalties     map[int]int
+	last          time.Time
+	lastIteration int
+}
+
+// ProgressReport is a snapshot of a Progress, encoded as one JSON object per line in JSON mode.
+type ProgressReport struct {
+	Time           time.Time   `json:"time"`
+	Iteration      int         `json:"iteration"`
+	Elapsed        float64     `json:"elapsed_seconds"`
+	Rate           float64     `json:"iterations_per_second"`
+	Best           int         `json:"best_score"`
+	Accepted       int         `json:"accepted"`
+	AcceptanceRate float64     `json:"acceptance_rate"`
+	Penalties      map[int]int `json:"penalties"`
+	ETA            float64     `json:"eta_seconds"`
+}
+
+type ProgressWriter interface {
+	Write(*ProgressReport) error
+}
+
+func NewProgress(writer ProgressWriter, interval time.Duration, start time.Time, iteration, total int) *Progress {
+	now := time.Now()
+	return &Progress{
+		Writer:        writer,
+		Interval:      interval,
+		Start:         start,
+		Total:         total,
+		Iteration:     iteration,
+		Best:          BAD,
+		Penalties:     make(map[int]int),
+		last:          now,
+		lastIteration: iteration,
+	}
+}
+
+func NewProgressWriter(mode string, writer io.Writer) (ProgressWriter, error) {
+	switch mode {
+	case PROGRESS_TERMINAL:
+		return &TerminalProgressWriter{
+			Writer: writer,
+		}, nil
+	case PROGRESS_JSON:
+		return &JSONProgressWriter{
+			Encoder: json.NewEncoder(writer),
+		}, nil
+	default:
+		return nil, errors.New("Unrecognized progress mode: " + mode)
+	}
+}
+
+// Update records the result of scoring the puzzle generated in the given iteration, and reports if the interval has passed.
+func (p *Progress) Update(iteration, score, penalty int) error {
+	p.Iteration = iteration + 1
+	if score >= 0 {
+		p.Penalties[penalty]++
+	}
+	if score > p.Best {
+		p.Best = score
+	}
+	if p.Writer == nil || p.Iteration%1000 != 0 {
+		return nil
+	}
+	if time.Since(p.last) < p.Interval {
+		return nil
+	}
+	return p.Report()
+}
+
+// Accept records that a generated puzzle was kept.
+func (p *Progress) Accept() {
+	p.Accepted++
+}
+
+func (p *Progress) Report() error {
+	if p.Writer == nil {
+		return nil
+	}
+	report := p.Snapshot()
+	p.last = report.Time
+	p.lastIteration = p.Iteration
+	return p.Writer.Write(report)
+}
+
+func (p *Progress) Snapshot() *ProgressReport {
+	now := time.Now()
+	report := &ProgressReport{
+		Time:      now,
+		Iteration: p.Iteration,
+		Elapsed:   now.Sub(p.Start).Seconds(),
+		Best:      p.Best,
+		Accepted:  p.Accepted,
+		Penalties: make(map[int]int, len(p.Penalties)),
+	}
+	if seconds := now.Sub(p.last).Seconds(); seconds > 0 {
+		report.Rate = float64(p.Iteration-p.lastIteration) / seconds
+	}
+	if p.Iteration > 0 {
+		report.AcceptanceRate = float64(p.Accepted) / float64(p.Iteration)
+	}
+	for k, v := range p.Penalties {
+		report.Penalties[k] = v
+	}
+	if report.Rate > 0 && p.Total > p.Iteration {
+		report.ETA = float64(p.Total-p.Iteration) / report.Rate
+	}
+	if !p.Deadline.IsZero() {
+		if remaining := p.Deadline.Sub(now).Seconds(); report.ETA == 0 || remaining < report.ETA {
+			report.ETA = remaining
+		}
+	}
+	return report
+}
+
+// TerminalProgressWriter writes each report as a single human readable line.
+type TerminalProgressWriter struct {
+	Writer io.Writer
+}
+
+func (w *TerminalProgressWriter) Write(report *ProgressReport) error {
+	penalties := make([]int, 0, len(report.Penalties))
+	for k := range report.Penalties {
+		penalties = append(penalties, k)
+	}
+	sort.Ints(penalties)
+	distribution := make([]string, 0, len(penalties))
+	for _, k := range penalties {
+		distribution = append(distribution, strconv.Itoa(k)+"="+strconv.Itoa(report.Penalties[k]))
+	}
+	_, err := fmt.Fprintf(w.Writer, "%s iteration %d (%.0f/s) elapsed %s best %d accepted %d (%.6f%%) penalties [%s] eta %s\n",
+		report.Time.Format("2006/01/02 15:04:05"),
+		report.Iteration,
+		report.Rate,
+		time.Duration(report.Elapsed*float64(time.Second)).Round(time.Second),
+		report.Best,
+		report.Accepted,
+		report.AcceptanceRate*100,
+		strings.Join(distribution, " "),
+		time.Duration(report.ETA*float64(time.Second)).Round(time.Second))
+	return err
+}
+
+// JSONProgressWriter writes each report as a line of JSON.
+type JSONProgressWriter struct {
+	Encoder *json.Encoder
+}
+
+func (w *JSONProgressWriter) Write(report *ProgressReport) error {
+	return w.Encoder.Encode(report)
+}
@@ -0,0 +1,246 @@
+/*
+ * Copyright 2019 Aletheia Ware LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package perspectiveeditorgo
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/AletheiaWareLLC/perspectivego"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// RATINGS_SUFFIX is appended to the name of a puzzle directory to name the file holding the ratings of its puzzles, which is kept beside the directory so it is never read as a puzzle
+	RATINGS_SUFFIX = ".ratings.txt"
+	// STAR_TWO_SOLUTIONS is the number of distinct solutions, up to the two star par, that a player has to choose from
+	STAR_TWO_SOLUTIONS = 4
+	// STAR_ONE_SOLUTIONS is the number of distinct solutions, up to the one star par, that a player has to choose from
+	STAR_ONE_SOLUTIONS = 16
+	// MAX_SOLUTION_COUNT caps the solution counts, which grow exponentially with rotations
+	MAX_SOLUTION_COUNT = 1 << 30
+)
+
+// Rating holds the most rotations a solution can take to earn three, two and one stars.
+type Rating struct {
+	Three int
+	Two   int
+	One   int
+	// Solutions counts the distinct move sequences which reach a goal with each number of rotations, up to the one star limit
+	Solutions map[int]int
+}
+
+// Stars returns the number of stars earned by a solution with the given number of rotations.
+func (r *Rating) Stars(rotations int) int {
+	switch {
+	case rotations <= r.Three:
+		return 3
+	case rotations <= r.Two:
+		return 2
+	case rotations <= r.One:
+		return 1
+	}
+	return 0
+}
+
+func (r *Rating) String() string {
+	return fmt.Sprintf("3 <= %d, 2 <= %d, 1 <= %d", r.Three, r.Two, r.One)
+}
+
+// RatePuzzle computes star thresholds from the optimal rotation count and the distribution of near-optimal solutions.
+// Three stars requires an optimal solution, as scored by ScoreBounds so the par matches the target it gives the puzzle. The two star par is the fewest rotations with at least STAR_TWO_SOLUTIONS solutions at or below it,
+// and the one star par likewise with STAR_ONE_SOLUTIONS, so puzzles with few near-optimal solutions are graded more leniently.
+// The two star par is at most 2 * optimal + 1, and the one star par at most 3 * optimal + 2.
+// Solutions are counted under the given bounds, which should be those the puzzle was scored with. Rotations are changes of gravity,
+// as counted by the gravity scorer, so ratings do not apply to scores in quarter turns.
+func RatePuzzle(puzzle *perspectivego.Puzzle, bounds *Bounds) (*Rating, error) {
+	if len(puzzle.Sphere) == 0 {
+		return nil, errors.New("Puzzle has no sphere")
+	}
+	optimal, _ := ScoreBounds(puzzle, bounds)
+	if optimal == BAD {
+		return nil, errors.New("Puzzle cannot be solved")
+	}
+	limit := 3*optimal + 2
+	solutions := CountSolutions(puzzle, bounds, limit)
+	rating := &Rating{
+		Three:     optimal,
+		Solutions: solutions,
+	}
+	par := func(from, needed, max int) int {
+		total := 0
+		for r := 0; r < from; r++ {
+			total += solutions[r]
+		}
+		for r := from; r < max; r++ {
+			total += solutions[r]
+			if total >= needed {
+				return r
+			}
+		}
+		return max
+	}
+	rating.Two = par(optimal+1, STAR_TWO_SOLUTIONS, 2*optimal+1)
+	rating.One = par(rating.Two+1, STAR_ONE_SOLUTIONS, limit)
+	return rating, nil
+}
+
+// CountSolutions returns the number of distinct move sequences, as accepted by VerifySolution, which reach a goal with each number of rotations up to the limit.
+func CountSolutions(puzzle *perspectivego.Puzzle, bounds *Bounds, limit int) map[int]int {
+	solutions := make(map[int]int)
+	if len(puzzle.Sphere) == 0 {
+		return solutions
+	}
+	simulation := NewBoundedSimulation(puzzle, bounds)
+	type state struct {
+		location  *perspectivego.Location
+		direction *perspectivego.Location
+		portaled  bool
+	}
+	// layers[r] maps each resting state to its number of sequences with r rotations
+	layers := make([]map[string]int, limit+2)
+	states := make(map[string]*state)
+	for i := range layers {
+		layers[i] = make(map[string]int)
+	}
+	add := func(r int, count int, location, direction *perspectivego.Location, portaled bool, outcome int) {
+		if r > limit {
+			return
+		}
+		switch outcome {
+		case WALK_GOAL:
+			solutions[r] = capCount(solutions[r] + count)
+		case WALK_REST:
+			key := restKey(location, direction, portaled)
+			states[key] = &state{location, direction, portaled}
+			layers[r][key] = capCount(layers[r][key] + count)
+		}
+	}
+	start := puzzle.Sphere[0].Location
+	for _, d := range directions {
+		location, direction, portaled, _, outcome := simulation.Walk(start, d, false)
+		r := 1
+		if d == down {
+			r = 0
+		}
+		add(r, 1, location, direction, portaled, outcome)
+	}
+	for r := 0; r < limit; r++ {
+		for key, count := range layers[r] {
+			s := states[key]
+			for _, d := range directions {
+				if d == s.direction {
+					continue
+				}
+				location, direction, portaled, _, outcome := simulation.Walk(s.location, d, s.portaled)
+				add(r+1, count, location, direction, portaled, outcome)
+			}
+		}
+	}
+	return solutions
+}
+
+func capCount(count int) int {
+	if count > MAX_SOLUTION_COUNT {
+		return MAX_SOLUTION_COUNT
+	}
+	return count
+}
+
+// RatingsPath returns the path of the ratings file for the puzzles in the given directory.
+func RatingsPath(directory string) (string, error) {
+	absolute, err := filepath.Abs(directory)
+	if err != nil {
+		return "", err
+	}
+	return absolute + RATINGS_SUFFIX, nil
+}
+
+// ReadRatingsFile reads the ratings in the given file, keyed by PuzzleHash.
+func ReadRatingsFile(path string) (map[string]*Rating, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadRatings(file)
+}
+
+// ReadRatings reads one rating:<puzzle hash>:<three>:<two>:<one> line per puzzle.
+func ReadRatings(reader io.Reader) (map[string]*Rating, error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Split(bufio.ScanLines)
+
+	ratings := make(map[string]*Rating)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.Split(line, ":")
+		if parts[0] != "rating" || len(parts) != 5 {
+			return nil, errors.New("Malformed rating: " + line)
+		}
+		var pars [3]int
+		for i := range pars {
+			p, err := strconv.Atoi(parts[2+i])
+			if err != nil {
+				return nil, err
+			}
+			pars[i] = p
+		}
+		ratings[parts[1]] = &Rating{
+			Three: pars[0],
+			Two:   pars[1],
+			One:   pars[2],
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ratings, nil
+}
+
+func WriteRatingsFile(path string, ratings map[string]*Rating) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return WriteRatings(file, ratings)
+}
+
+// WriteRatings writes the ratings sorted by puzzle hash.
+func WriteRatings(writer io.Writer, ratings map[string]*Rating) error {
+	hashes := make([]string, 0, len(ratings))
+	for h := range ratings {
+		hashes = append(hashes, h)
+	}
+	sort.Strings(hashes)
+	for _, h := range hashes {
+		r := ratings[h]
+		if _, err := fmt.Fprintln(writer, "rating:"+h+":"+strconv.Itoa(r.Three)+":"+strconv.Itoa(r.Two)+":"+strconv.Itoa(r.One)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,313 @@
+/*
+ * Copyright 2019 Aletheia Ware LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package perspectiveeditorgo
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/AletheiaWareLLC/perspectivego"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// REPLAY_VERSION is the version of the replay format, which has one <key>:<value> line each for replay, puzzle, size and optionally bounds and seed,
+// followed by one move:<milliseconds>:<direction> line per rotation, timed from the start of the replay. Replays without a bounds line use legacy bounds:
+//
+//	replay:1
+//	puzzle:<sha-256 of the canonical puzzle>
+//	size:5
+//	bounds:wall
+//	seed:1234
+//	move:0:down
+//	move:1000:left
+const REPLAY_VERSION = 1
+
+// REPLAY_INTERVAL is the time in milliseconds between the moves of a replay recorded from the solver
+const REPLAY_INTERVAL = 1000
+
+type ReplayMove struct {
+	// Timestamp is the number of milliseconds since the start of the replay
+	Timestamp uint64
+	Direction *perspectivego.Location
+}
+
+type Replay struct {
+	// Hash identifies the puzzle, as returned by PuzzleHash
+	Hash string
+	Size uint32
+	// Model is the bounds model the moves were played under
+	Model string
+	// Seed is the seed the puzzle was generated from, if Seeded
+	Seed   int64
+	Seeded bool
+	Moves  []*ReplayMove
+}
+
+// ReplayStep is the result of playing one move of a replay.
+type ReplayStep struct {
+	Index     int
+	Timestamp uint64
+	Direction *perspectivego.Location
+	// Location is where the sphere stopped, and Gravity the direction of gravity there, which differs from Direction after a reorienting portal
+	Location *perspectivego.Location
+	Gravity  *perspectivego.Location
+	Portals  []string
+	Outcome  int
+}
+
+// Playback replays a replay against a puzzle one move at a time.
+type Playback struct {
+	Replay     *Replay
+	Simulation *Simulation
+	Location   *perspectivego.Location
+	Gravity    *perspectivego.Location
+	// Portaled is true if the sphere came to rest on arriving through a portal
+	Portaled  bool
+	Rotations int
+	Next      int
+	Done      bool
+}
+
+// PuzzleHash returns the hex encoded SHA-256 hash of the puzzle's canonical form.
+func PuzzleHash(puzzle *perspectivego.Puzzle) string {
+	hash := sha256.Sum256([]byte(CanonicalPuzzle(puzzle)))
+	return hex.EncodeToString(hash[:])
+}
+
+// RecordSolution returns a replay of the given moves, spaced REPLAY_INTERVAL apart.
+func RecordSolution(puzzle *perspectivego.Puzzle, size uint32, model string, moves []*perspectivego.Location) *Replay {
+	replay := &Replay{
+		Hash:  PuzzleHash(puzzle),
+		Size:  size,
+		Model: model,
+	}
+	for i, m := range moves {
+		replay.Moves = append(replay.Moves, &ReplayMove{
+			Timestamp: uint64(i * REPLAY_INTERVAL),
+			Direction: m,
+		})
+	}
+	return replay
+}
+
+// RecordSolver returns a replay of the solver's optimal path through the puzzle, under the given bounds model.
+func RecordSolver(puzzle *perspectivego.Puzzle, size uint32, model string) (*Replay, error) {
+	bounds, err := NewBounds(model, size)
+	if err != nil {
+		return nil, err
+	}
+	moves := SolveBounds(puzzle, bounds)
+	if moves == nil {
+		return nil, errors.New("Puzzle cannot be solved")
+	}
+	return RecordSolution(puzzle, size, bounds.Model, moves), nil
+}
+
+// Bounds returns the bounds the replay was recorded under.
+func (r *Replay) Bounds() (*Bounds, error) {
+	return NewBounds(r.Model, r.Size)
+}
+
+// Directions returns the direction of each move of the replay.
+func (r *Replay) Directions() []*perspectivego.Location {
+	var directions []*perspectivego.Location
+	for _, m := range r.Moves {
+		directions = append(directions, m.Direction)
+	}
+	return directions
+}
+
+func ReadReplayFile(path string) (*Replay, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadReplay(file)
+}
+
+func ReadReplay(reader io.Reader) (*Replay, error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Split(bufio.ScanLines)
+
+	replay := &Replay{}
+	version := 0
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.Split(line, ":")
+		if len(parts) < 2 {
+			return nil, errors.New("Malformed line: " + line)
+		}
+		switch parts[0] {
+		case "replay":
+			v, err := strconv.Atoi(parts[1])
+			if err != nil {
+				return nil, err
+			}
+			if v != REPLAY_VERSION {
+				return nil, fmt.Errorf("Unsupported replay version: %d", v)
+			}
+			version = v
+		case "puzzle":
+			replay.Hash = parts[1]
+		case "size":
+			size, err := strconv.ParseUint(parts[1], 10, 32)
+			if err != nil {
+				return nil, err
+			}
+			replay.Size = uint32(size)
+		case "bounds":
+			replay.Model = parts[1]
+		case "seed":
+			seed, err := strconv.ParseInt(parts[1], 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			replay.Seed = seed
+			replay.Seeded = true
+		case "move":
+			if len(parts) != 3 {
+				return nil, errors.New("Malformed move: " + line)
+			}
+			timestamp, err := strconv.ParseUint(parts[1], 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			direction, err := ParseDirection(parts[2])
+			if err != nil {
+				return nil, err
+			}
+			replay.Moves = append(replay.Moves, &ReplayMove{
+				Timestamp: timestamp,
+				Direction: direction,
+			})
+		default:
+			return nil, errors.New("Unrecognized line: " + line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if version == 0 {
+		return nil, errors.New("Missing replay version")
+	}
+	return replay, nil
+}
+
+func WriteReplayFile(path string, replay *Replay) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return WriteReplay(file, replay)
+}
+
+func WriteReplay(writer io.Writer, replay *Replay) error {
+	if _, err := fmt.Fprintln(writer, "replay:"+strconv.Itoa(REPLAY_VERSION)); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(writer, "puzzle:"+replay.Hash); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(writer, "size:"+strconv.FormatUint(uint64(replay.Size), 10)); err != nil {
+		return err
+	}
+	if replay.Model != "" {
+		if _, err := fmt.Fprintln(writer, "bounds:"+replay.Model); err != nil {
+			return err
+		}
+	}
+	if replay.Seeded {
+		if _, err := fmt.Fprintln(writer, "seed:"+strconv.FormatInt(replay.Seed, 10)); err != nil {
+			return err
+		}
+	}
+	for _, m := range replay.Moves {
+		if _, err := fmt.Fprintln(writer, "move:"+strconv.FormatUint(m.Timestamp, 10)+":"+DirectionName(m.Direction)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewPlayback prepares the replay to be played against the puzzle, which must match the replay's hash, under the replay's size and bounds.
+func NewPlayback(replay *Replay, puzzle *perspectivego.Puzzle) (*Playback, error) {
+	if hash := PuzzleHash(puzzle); hash != replay.Hash {
+		return nil, errors.New("Replay is for a different puzzle: " + replay.Hash)
+	}
+	if len(puzzle.Sphere) == 0 {
+		return nil, errors.New("Puzzle has no sphere")
+	}
+	bounds, err := replay.Bounds()
+	if err != nil {
+		return nil, err
+	}
+	return &Playback{
+		Replay:     replay,
+		Simulation: NewBoundedSimulation(puzzle, bounds),
+		Location:   puzzle.Sphere[0].Location,
+	}, nil
+}
+
+// Step plays the next move, returning nil once the replay has finished or reached an outcome other than resting.
+// Moves following a goal, a fall or a portal loop are an error, as is a move which does not change gravity.
+func (p *Playback) Step() (*ReplayStep, error) {
+	if p.Done || p.Next >= len(p.Replay.Moves) {
+		return nil, nil
+	}
+	m := p.Replay.Moves[p.Next]
+	if p.Next == 0 {
+		if m.Direction != down {
+			p.Rotations++
+		}
+	} else {
+		if m.Direction == p.Gravity {
+			return nil, fmt.Errorf("Move %d: Gravity is already %s", p.Next, DirectionName(m.Direction))
+		}
+		p.Rotations++
+	}
+	location, gravity, portaled, portals, outcome := p.Simulation.Walk(p.Location, m.Direction, p.Portaled)
+	step := &ReplayStep{
+		Index:     p.Next,
+		Timestamp: m.Timestamp,
+		Direction: m.Direction,
+		Location:  location,
+		Gravity:   gravity,
+		Portals:   portals,
+		Outcome:   outcome,
+	}
+	p.Location = location
+	p.Gravity = gravity
+	p.Portaled = portaled
+	p.Next++
+	if outcome != WALK_REST {
+		p.Done = true
+		if p.Next < len(p.Replay.Moves) {
+			return step, fmt.Errorf("Move %d: Replay continues after the sphere stopped", p.Next)
+		}
+	}
+	return step, nil
+}
@@ -0,0 +1,467 @@
+/*
+ * Copyright 2019 Aletheia Ware LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package perspectiveeditorgo
+
+import (
+	"errors"
+	"fmt"
+	"github.com/AletheiaWareLLC/perspectivego"
+	"math/rand"
+	"strconv"
+)
+
+const (
+	// RETROGRADE_ATTEMPTS is the default number of constructions tried before giving up
+	RETROGRADE_ATTEMPTS = 10000
+	// RETROGRADE_CHOICES is the number of random choices tried for each roll before the construction is abandoned
+	RETROGRADE_CHOICES = 32
+)
+
+// Roles of the cells reserved by a construction
+const (
+	RETROGRADE_PATH = iota + 1
+	RETROGRADE_BLOCK
+	RETROGRADE_GOAL
+	RETROGRADE_PORTAL
+)
+
+// Retrograde describes a puzzle to be constructed backwards from its goal.
+type Retrograde struct {
+	// Rotations is the number of rotations the puzzle must need
+	Rotations int
+	// Portals is the number of rolls routed through a pair of portals
+	Portals int
+	// Attempts limits the number of constructions tried
+	Attempts int
+	Goal     *ElementStyle
+	Sphere   *ElementStyle
+	Block    *ElementStyle
+	Portal   *ElementStyle
+}
+
+// Roll is one movement of the sphere under a gravity direction, from a resting location to where it stops.
+type Roll struct {
+	Direction *perspectivego.Location
+	From      *perspectivego.Location
+	To        *perspectivego.Location
+	// Entrance and Exit are the portals the roll passes through, or nil
+	Entrance *perspectivego.Location
+	Exit     *perspectivego.Location
+}
+
+// construction holds the cells reserved while building a puzzle backwards
+type construction struct {
+	volume *Volume
+	bounds *Bounds
+	goal   cell
+	min    [3]int32
+	max    [3]int32
+	cells  map[cell]int
+	rolls  []*Roll
+	blocks []cell
+	// portals holds the entrance and exit of each pair
+	portals [][2]cell
+	// fixed holds the direction of each roll, or is nil for directions to be chosen at random
+	fixed []*perspectivego.Location
+}
+
+func newConstruction(volume *Volume, bounds *Bounds) (*construction, error) {
+	extent, err := volume.Bounds(BOUNDS_FALL)
+	if err != nil {
+		return nil, err
+	}
+	return &construction{
+		volume: volume,
+		bounds: bounds,
+		min:    extent.Min,
+		max:    extent.Max,
+		cells:  make(map[cell]int),
+	}, nil
+}
+
+// GenerateRetrograde builds a puzzle within the volume by choosing the sphere's rolls backwards from a randomly placed goal.
+// The last roll ends at the goal, and each earlier roll ends against a block placed exactly where the sphere must stop, with the cells it rolls through kept empty.
+// The first roll is down, so a sequence of Rotations + 1 rolls needs Rotations rotations. Shortcuts and other routes as short are ruled out with OptimalSolutions,
+// and constructions are retried until the rolls are the unique optimal solution; the puzzle's target is then set by ScoreBounds, which is at least as many.
+func GenerateRetrograde(seed int64, puzzle *perspectivego.Puzzle, volume *Volume, bounds *Bounds, retrograde *Retrograde) (*perspectivego.Puzzle, []*Roll, error) {
+	if retrograde.Rotations < 0 {
+		return nil, nil, errors.New("Rotations must not be negative")
+	}
+	if retrograde.Portals < 0 || retrograde.Portals > retrograde.Rotations+1 {
+		return nil, nil, errors.New("Portals must be between 0 and the number of rolls")
+	}
+	for _, s := range []*ElementStyle{retrograde.Goal, retrograde.Sphere, retrograde.Block} {
+		if s == nil || !s.Valid() {
+			return nil, nil, errors.New("Goal, sphere and block styles must each have a mesh, colour, texture and material")
+		}
+	}
+	if retrograde.Portals > 0 && (retrograde.Portal == nil || !retrograde.Portal.Valid()) {
+		return nil, nil, errors.New("Portal style must have a mesh, colour, texture and material")
+	}
+	attempts := retrograde.Attempts
+	if attempts <= 0 {
+		attempts = RETROGRADE_ATTEMPTS
+	}
+	rand.Seed(seed)
+	for attempt := 0; attempt < attempts; attempt++ {
+		c, err := newConstruction(volume, bounds)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !c.build(retrograde.Rotations, retrograde.Portals) {
+			continue
+		}
+		candidate := c.puzzle(puzzle, retrograde)
+		if SolutionRotations(c.moves()) != retrograde.Rotations || !c.unique(candidate) {
+			continue
+		}
+		r, _ := ScoreBounds(candidate, bounds)
+		if r < retrograde.Rotations {
+			continue
+		}
+		candidate.Target = uint32(r)
+		return candidate, c.rolls, nil
+	}
+	return nil, nil, fmt.Errorf("No puzzle needing %d rotations was constructed in %d attempts", retrograde.Rotations, attempts)
+}
+
+// build chooses the rolls backwards from the goal, returning false if it reaches a dead end.
+// A roll with no valid choice sends construction back to choose the roll after it again, up to RETROGRADE_CHOICES times.
+func (c *construction) build(rotations, portals int) bool {
+	count := rotations + 1
+	// Choose which rolls pass through portals
+	routed := make(map[int]bool)
+	for _, i := range rand.Perm(count)[:portals] {
+		routed[i] = true
+	}
+	c.goal = c.randomCell()
+	c.cells[c.goal] = RETROGRADE_GOAL
+	rolls := make([]*Roll, count)
+	// snapshots holds the reserved cells, blocks and portals before each roll was chosen
+	snapshots := make([]*construction, count)
+	backtracks := 0
+	for i := count - 1; i >= 0; {
+		end := c.goal
+		var later []*perspectivego.Location
+		if i < count-1 {
+			end = cellOf(rolls[i+1].From)
+			for _, r := range rolls[i+1:] {
+				later = append(later, r.Direction)
+			}
+		}
+		snapshots[i] = c.snapshot()
+		roll := c.chooseRoll(i, end, later, routed[i])
+		if roll == nil {
+			if i == count-1 || backtracks >= RETROGRADE_CHOICES {
+				return false
+			}
+			backtracks++
+			i++
+			c.restore(snapshots[i])
+			continue
+		}
+		rolls[i] = roll
+		i--
+	}
+	c.rolls = rolls
+	return true
+}
+
+// snapshot returns a copy of the reserved cells, blocks and portals.
+func (c *construction) snapshot() *construction {
+	s := &construction{
+		cells:   make(map[cell]int, len(c.cells)),
+		blocks:  append([]cell{}, c.blocks...),
+		portals: append([][2]cell{}, c.portals...),
+	}
+	for k, v := range c.cells {
+		s.cells[k] = v
+	}
+	return s
+}
+
+// restore returns the reserved cells, blocks and portals to those of the snapshot.
+func (c *construction) restore(s *construction) {
+	c.cells = s.cells
+	c.blocks = s.blocks
+	c.portals = s.portals
+}
+
+// chooseRoll picks a roll ending at the given cell, before the rolls with the given directions, and reserves its cells.
+// Rolls which would let the sphere reach the goal from their start in fewer rotations than the rolls chosen so far are rejected, so shortcuts are pruned as they appear.
+func (c *construction) chooseRoll(index int, end cell, later []*perspectivego.Location, routed bool) *Roll {
+	var next *perspectivego.Location
+	if len(later) > 0 {
+		next = later[0]
+	}
+	for choice := 0; choice < RETROGRADE_CHOICES; choice++ {
+		direction := down
+		if c.fixed != nil {
+			direction = c.fixed[index]
+		} else if index > 0 {
+			direction = directions[rand.Intn(len(directions))]
+		}
+		if next != nil && !perpendicular(direction, next) {
+			continue
+		}
+		reserved := make(map[cell]int)
+		if next != nil {
+			// The sphere rests at the end of the roll against a block in the direction of gravity
+			block := c.step(end, direction, 1)
+			if !c.inside(block) || !c.available(block, RETROGRADE_BLOCK, reserved) {
+				continue
+			}
+			reserved[block] = RETROGRADE_BLOCK
+		}
+		roll := &Roll{
+			Direction: direction,
+			To:        locationOf(end),
+		}
+		start, ok := c.segment(end, direction, reserved)
+		if !ok {
+			continue
+		}
+		if routed {
+			// The sphere leaves the exit where the segment starts, having entered a portal elsewhere rolling the same way
+			exit := start
+			if c.cells[exit] != 0 {
+				continue
+			}
+			entrance := c.randomCell()
+			if c.cells[entrance] != 0 || reserved[entrance] != 0 {
+				continue
+			}
+			reserved[exit] = RETROGRADE_PORTAL
+			reserved[entrance] = RETROGRADE_PORTAL
+			start, ok = c.segment(entrance, direction, reserved)
+			if !ok {
+				continue
+			}
+			roll.Entrance = locationOf(entrance)
+			roll.Exit = locationOf(exit)
+		}
+		if index > 0 && !c.extendable(start, direction, reserved) {
+			continue
+		}
+		var pair *[2]cell
+		if routed {
+			pair = &[2]cell{cellOf(roll.Entrance), cellOf(roll.Exit)}
+		}
+		if !c.necessary(reserved, pair, start, append([]*perspectivego.Location{direction}, later...)) {
+			continue
+		}
+		c.commit(reserved, pair)
+		roll.From = locationOf(start)
+		return roll
+	}
+	return nil
+}
+
+// commit adds the reserved cells, and the portal pair if any, to the construction.
+func (c *construction) commit(reserved map[cell]int, pair *[2]cell) {
+	for k, v := range reserved {
+		if c.cells[k] == 0 || v != RETROGRADE_PATH {
+			c.cells[k] = v
+		}
+		if v == RETROGRADE_BLOCK {
+			c.blocks = append(c.blocks, k)
+		}
+	}
+	if pair != nil {
+		c.portals = append(c.portals, *pair)
+	}
+}
+
+// extendable returns true if a roll turning from the given direction could end at the given cell.
+func (c *construction) extendable(end cell, direction *perspectivego.Location, reserved map[cell]int) bool {
+	for _, d := range directions {
+		if !perpendicular(d, direction) {
+			continue
+		}
+		block := c.step(end, d, 1)
+		previous := c.step(end, d, -1)
+		if c.inside(block) && c.available(block, RETROGRADE_BLOCK, reserved) && c.inside(previous) && c.available(previous, RETROGRADE_PATH, reserved) {
+			return true
+		}
+	}
+	return false
+}
+
+// perpendicular returns true if the directions are at right angles; rolling back along the line of the next roll would start on its path, making it a shortcut.
+func perpendicular(a, b *perspectivego.Location) bool {
+	return a.X*b.X+a.Y*b.Y+a.Z*b.Z == 0
+}
+
+// necessary returns true if, once the reserved cells and portal pair are added, the sphere starting at the given cell can reach the goal but needs at least as many rotations as the given rolls.
+func (c *construction) necessary(reserved map[cell]int, pair *[2]cell, start cell, rolls []*perspectivego.Location) bool {
+	puzzle := &perspectivego.Puzzle{
+		Goal:   []*perspectivego.Goal{{Location: locationOf(c.goal)}},
+		Sphere: []*perspectivego.Sphere{{Location: locationOf(start)}},
+	}
+	for _, b := range c.blocks {
+		puzzle.Block = append(puzzle.Block, &perspectivego.Block{Location: locationOf(b)})
+	}
+	for k, v := range reserved {
+		if v == RETROGRADE_BLOCK {
+			puzzle.Block = append(puzzle.Block, &perspectivego.Block{Location: locationOf(k)})
+		}
+	}
+	pairs := c.portals
+	if pair != nil {
+		pairs = append(append([][2]cell{}, pairs...), *pair)
+	}
+	for _, p := range pairs {
+		for j := range p {
+			puzzle.Portal = append(puzzle.Portal, &perspectivego.Portal{
+				Location: locationOf(p[j]),
+				Link:     PortalLink(locationOf(p[1-j])),
+			})
+		}
+	}
+	moves := SolveBounds(puzzle, c.bounds)
+	return moves != nil && SolutionRotations(moves) >= SolutionRotations(rolls)
+}
+
+// segment picks a random length of empty cells leading back from the given cell against the direction, reserving them as path, and returns where the segment starts.
+func (c *construction) segment(end cell, direction *perspectivego.Location, reserved map[cell]int) (cell, bool) {
+	var cells []cell
+	for k := 1; ; k++ {
+		previous := c.step(end, direction, -k)
+		if !c.inside(previous) || !c.available(previous, RETROGRADE_PATH, reserved) {
+			break
+		}
+		cells = append(cells, previous)
+	}
+	if len(cells) == 0 {
+		return end, false
+	}
+	length := rand.Intn(len(cells)) + 1
+	for _, p := range cells[:length] {
+		if reserved[p] == 0 {
+			reserved[p] = RETROGRADE_PATH
+		}
+	}
+	return cells[length-1], true
+}
+
+// available returns true if the cell can take the given role, given what is already reserved.
+func (c *construction) available(x cell, role int, reserved map[cell]int) bool {
+	existing := reserved[x]
+	if existing == 0 {
+		existing = c.cells[x]
+	}
+	switch existing {
+	case 0:
+		return true
+	case RETROGRADE_PATH:
+		// Paths may cross each other, but nothing can be placed on them
+		return role == RETROGRADE_PATH
+	case RETROGRADE_BLOCK:
+		// Rolls may share a block to stop against
+		return role == RETROGRADE_BLOCK
+	}
+	return false
+}
+
+func (c *construction) inside(x cell) bool {
+	for i := range x {
+		if x[i] < c.min[i] || x[i] > c.max[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *construction) step(x cell, direction *perspectivego.Location, k int) cell {
+	return cell{x[0] + int32(k)*direction.X, x[1] + int32(k)*direction.Y, x[2] + int32(k)*direction.Z}
+}
+
+func (c *construction) randomCell() cell {
+	return cell{
+		int32(RandomLocation(c.volume.Width)),
+		int32(RandomLocation(c.volume.Height)),
+		int32(RandomLocation(c.volume.Depth)),
+	}
+}
+
+// puzzle returns a copy of the given puzzle holding the constructed elements.
+func (c *construction) puzzle(template *perspectivego.Puzzle, r *Retrograde) *perspectivego.Puzzle {
+	puzzle := &perspectivego.Puzzle{
+		Outline:     template.Outline,
+		Description: template.Description,
+	}
+	goal := c.rolls[len(c.rolls)-1].To
+	puzzle.Goal = append(puzzle.Goal, &perspectivego.Goal{
+		Name:     "g0",
+		Mesh:     r.Goal.Mesh[0],
+		Colour:   r.Goal.Colour[0],
+		Location: goal,
+		Texture:  r.Goal.Texture[0],
+		Material: r.Goal.Material[0],
+		Shader:   r.Goal.Shader,
+	})
+	puzzle.Sphere = append(puzzle.Sphere, &perspectivego.Sphere{
+		Name:     "s0",
+		Mesh:     r.Sphere.Mesh[0],
+		Colour:   r.Sphere.Colour[0],
+		Location: c.rolls[0].From,
+		Texture:  r.Sphere.Texture[0],
+		Material: r.Sphere.Material[0],
+		Shader:   r.Sphere.Shader,
+	})
+	seen := make(map[cell]bool)
+	for _, b := range c.blocks {
+		if seen[b] {
+			continue
+		}
+		seen[b] = true
+		i := len(puzzle.Block)
+		puzzle.Block = append(puzzle.Block, &perspectivego.Block{
+			Name:     "b" + strconv.Itoa(i),
+			Mesh:     r.Block.Mesh[i%len(r.Block.Mesh)],
+			Colour:   r.Block.Colour[i%len(r.Block.Colour)],
+			Location: locationOf(b),
+			Texture:  r.Block.Texture[i%len(r.Block.Texture)],
+			Material: r.Block.Material[i%len(r.Block.Material)],
+			Shader:   r.Block.Shader,
+		})
+	}
+	for group, pair := range c.portals {
+		for j, p := range pair {
+			i := len(puzzle.Portal)
+			puzzle.Portal = append(puzzle.Portal, &perspectivego.Portal{
+				Name:     "p" + strconv.Itoa(i),
+				Mesh:     r.Portal.Mesh[i%len(r.Portal.Mesh)],
+				Colour:   r.Portal.Colour[group%len(r.Portal.Colour)],
+				Location: locationOf(p),
+				Link:     PortalLink(locationOf(pair[1-j])),
+				Texture:  r.Portal.Texture[group%len(r.Portal.Texture)],
+				Material: r.Portal.Material[group%len(r.Portal.Material)],
+				Shader:   r.Portal.Shader,
+			})
+		}
+	}
+	return puzzle
+}
+
+func locationOf(x cell) *perspectivego.Location {
+	return &perspectivego.Location{
+		X: x[0],
+		Y: x[1],
+		Z: x[2],
+	}
+}
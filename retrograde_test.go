@@ -0,0 +1,84 @@
+/*
+ * Copyright 2019 Aletheia Ware LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package perspectiveeditorgo
+
+import (
+	"github.com/AletheiaWareLLC/perspectivego"
+	"testing"
+)
+
+func testStyle() *ElementStyle {
+	s := []string{"box"}
+	return &ElementStyle{
+		Mesh:     s,
+		Colour:   []string{"#ffffff"},
+		Texture:  s,
+		Material: s,
+		Shader:   "main",
+	}
+}
+
+func rollDirections(rolls []*Roll) []*perspectivego.Location {
+	var moves []*perspectivego.Location
+	for _, r := range rolls {
+		moves = append(moves, r.Direction)
+	}
+	return moves
+}
+
+func TestGenerateRetrograde(t *testing.T) {
+	volume := CubeVolume(5)
+	for _, model := range []string{BOUNDS_FALL, BOUNDS_WALL} {
+		bounds, err := volume.Bounds(model)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for seed := int64(0); seed < 8; seed++ {
+			retrograde := &Retrograde{
+				Rotations: int(seed % 5),
+				Portals:   int(seed % 2),
+				Goal:      testStyle(),
+				Sphere:    testStyle(),
+				Block:     testStyle(),
+				Portal:    testStyle(),
+			}
+			puzzle, rolls, err := GenerateRetrograde(seed, &perspectivego.Puzzle{}, volume, bounds, retrograde)
+			if err != nil {
+				t.Fatalf("%s seed %d: %v", model, seed, err)
+			}
+			if r, _ := ScoreBounds(puzzle, bounds); r < retrograde.Rotations {
+				t.Fatalf("%s seed %d: expected at least %d rotations, scored %d", model, seed, retrograde.Rotations, r)
+			}
+			moves := SolveBounds(puzzle, bounds)
+			if !equalMoves(moves, rollDirections(rolls)) {
+				t.Fatalf("%s seed %d: solved %v, rolled %v", model, seed, moves, rollDirections(rolls))
+			}
+		}
+	}
+}
+
+func TestGenerateRetrogradeRejectsNegativeRotations(t *testing.T) {
+	retrograde := &Retrograde{
+		Rotations: -1,
+		Goal:      testStyle(),
+		Sphere:    testStyle(),
+		Block:     testStyle(),
+	}
+	if _, _, err := GenerateRetrograde(0, &perspectivego.Puzzle{}, CubeVolume(5), LegacyBounds(5), retrograde); err == nil {
+		t.Fatal("Expected an error")
+	}
+}
@@ -59,6 +59,11 @@ var (
 // Score: number of rotations needed to navigate to goal
 // Penalty: number of unvisitable elements
 func Score(puzzle *perspectivego.Puzzle, size uint32) (int, int) {
+	return ScoreBounds(puzzle, LegacyBounds(size))
+}
+
+// ScoreBounds is like Score but applies the given bounds model at the edge of the world.
+func ScoreBounds(puzzle *perspectivego.Puzzle, bounds *Bounds) (int, int) {
 	// log.Println("Scoring Puzzle:", puzzle)
 	// TODO support multiple spheres
 	sphere := puzzle.Sphere[0]
@@ -70,13 +75,16 @@ func Score(puzzle *perspectivego.Puzzle, size uint32) (int, int) {
 	for _, g := range puzzle.Goal {
 		goals[g.Location.String()] = true
 	}
-	portals := make(map[string]*perspectivego.Location, len(puzzle.Portal))
+	portals := make(map[string]*perspectivego.Portal, len(puzzle.Portal))
 	for _, p := range puzzle.Portal {
-		portals[p.Location.String()] = p.Link
+		// Exits can be arrived at but not entered
+		if !IsExit(p) {
+			portals[p.Location.String()] = p
+		}
 	}
 	tested := make(map[string]int)
 	visited := make(map[string]bool)
-	rotations, direction := ScoreDirections(blocks, goals, portals, size, sphere.Location, tested, visited, false)
+	rotations, direction := ScoreDirectionsBounds(blocks, goals, portals, bounds, sphere.Location, tested, visited, false)
 	if direction != down {
 		// Add initial rotation
 		rotations += 1
@@ -100,6 +108,12 @@ func Score(puzzle *perspectivego.Puzzle, size uint32) (int, int) {
 }
 
 func ScoreDirections(blocks, goals map[string]bool, portals map[string]*perspectivego.Location, size uint32, sphere *perspectivego.Location, tested map[string]int, visited map[string]bool, portaled bool) (int, *perspectivego.Location) {
+	return ScoreDirectionsBounds(blocks, goals, linkedPortals(portals), LegacyBounds(size), sphere, tested, visited, portaled)
+}
+
+// ScoreDirectionsBounds is like ScoreDirections but applies the given bounds model at the edge of the world, and takes the portals
+// themselves so they can change gravity.
+func ScoreDirectionsBounds(blocks, goals map[string]bool, portals map[string]*perspectivego.Portal, bounds *Bounds, sphere *perspectivego.Location, tested map[string]int, visited map[string]bool, portaled bool) (int, *perspectivego.Location) {
 	min := BAD
 	dir := down
 	posId := sphere.String()
@@ -108,7 +122,7 @@ func ScoreDirections(blocks, goals map[string]bool, portals map[string]*perspect
 		rotations, ok := tested[id]
 		if !ok {
 			tested[id] = BAD // Set now, update later to avoid loops
-			rotations = ScoreDirection(blocks, goals, portals, size, d, &perspectivego.Location{
+			rotations = ScoreDirectionBounds(blocks, goals, portals, bounds, d, &perspectivego.Location{
 				X: sphere.X,
 				Y: sphere.Y,
 				Z: sphere.Z,
@@ -124,13 +138,21 @@ func ScoreDirections(blocks, goals map[string]bool, portals map[string]*perspect
 }
 
 func ScoreDirection(blocks, goals map[string]bool, portals map[string]*perspectivego.Location, size uint32, direction *perspectivego.Location, sphere *perspectivego.Location, tested map[string]int, visited map[string]bool, portaled bool) int {
+	return ScoreDirectionBounds(blocks, goals, linkedPortals(portals), LegacyBounds(size), direction, sphere, tested, visited, portaled)
+}
+
+// ScoreDirectionBounds is like ScoreDirection but applies the given bounds model at the edge of the world, and takes the portals
+// themselves so they can change gravity.
+func ScoreDirectionBounds(blocks, goals map[string]bool, portals map[string]*perspectivego.Portal, bounds *Bounds, direction *perspectivego.Location, sphere *perspectivego.Location, tested map[string]int, visited map[string]bool, portaled bool) int {
 	// log.Println("Scoring Direction:", direction)
 	rotations := 0
 	// Tracks portal usage to prevent infinite portal loops
 	usage := make(map[string]int)
+	// Tracks where the sphere wraps around to prevent falling forever
+	wraps := make(map[string]bool)
 	for {
 		// log.Println("Sphere:", sphere)
-		if Abs(sphere.X) > size || Abs(sphere.Y) > size || Abs(sphere.Z) > size {
+		if !bounds.Contains(sphere) {
 			// log.Println("Out of Bounds")
 			return BAD
 		}
@@ -140,21 +162,24 @@ func ScoreDirection(blocks, goals map[string]bool, portals map[string]*perspecti
 			return rotations
 		}
 		if !portaled {
-			link, ok := portals[key]
+			portal, ok := portals[key]
 			if ok {
 				uses, ok := usage[key]
 				if !ok {
 					uses = 0
 				}
-				if uses < 6 {
+				if uses < MAX_PORTAL_USES {
 					// log.Println("Portal")
-					sphere.X = link.X
-					sphere.Y = link.Y
-					sphere.Z = link.Z
+					sphere.X = portal.Link.X
+					sphere.Y = portal.Link.Y
+					sphere.Z = portal.Link.Z
+					if gravity := PortalGravity(portal); gravity != nil {
+						direction = gravity
+					}
 					portaled = true
 					usage[key] = uses + 1
 					visited[key] = true
-					visited[link.String()] = true
+					visited[sphere.String()] = true
 					continue
 				} else {
 					// log.Println("Infinite Portal Loop")
@@ -162,20 +187,26 @@ func ScoreDirection(blocks, goals map[string]bool, portals map[string]*perspecti
 				}
 			}
 		}
-		next := &perspectivego.Location{
-			X: sphere.X + direction.X,
-			Y: sphere.Y + direction.Y,
-			Z: sphere.Z + direction.Z,
-		}
-		if blocks[next.String()] {
+		next, ok, wrapped := bounds.Next(sphere, direction)
+		if !ok || blocks[next.String()] {
 			// log.Println("Block")
-			visited[next.String()] = true
-			r, _ := ScoreDirections(blocks, goals, portals, size, sphere, tested, visited, portaled)
+			if ok {
+				visited[next.String()] = true
+			}
+			r, _ := ScoreDirectionsBounds(blocks, goals, portals, bounds, sphere, tested, visited, portaled)
 			if r >= 0 {
 				return r + rotations + GOOD
 			}
 			return r
 		}
+		if wrapped {
+			key := next.String() + direction.String()
+			if wraps[key] {
+				// log.Println("Infinite Wrap Loop")
+				return BAD
+			}
+			wraps[key] = true
+		}
 		sphere.X = next.X
 		sphere.Y = next.Y
 		sphere.Z = next.Z
@@ -183,6 +214,17 @@ func ScoreDirection(blocks, goals map[string]bool, portals map[string]*perspecti
 	}
 }
 
+// linkedPortals returns portals with the given links, none of which change gravity.
+func linkedPortals(links map[string]*perspectivego.Location) map[string]*perspectivego.Portal {
+	portals := make(map[string]*perspectivego.Portal, len(links))
+	for k, l := range links {
+		portals[k] = &perspectivego.Portal{
+			Link: l,
+		}
+	}
+	return portals
+}
+
 func Abs(a int32) uint32 {
 	if a < 0 {
 		return uint32(-a)
@@ -0,0 +1,178 @@
+/*
+ * Copyright 2019 Aletheia Ware LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package perspectiveeditorgo
+
+import (
+	"errors"
+	"github.com/AletheiaWareLLC/perspectivego"
+	"os"
+	"time"
+)
+
+const DEFAULT_MAX_ITERATIONS = 1000000000
+
+const (
+	STOP_COMPLETE    = "complete"
+	STOP_INTERRUPTED = "interrupted"
+	STOP_ITERATIONS  = "max iterations"
+	STOP_DURATION    = "max duration"
+	STOP_ACCEPTED    = "max accepted"
+	STOP_STALE       = "no improvement"
+)
+
+// ErrSearchComplete is returned by Search.Accept to stop the search successfully.
+var ErrSearchComplete = errors.New("Search complete")
+
+// Budget holds the stop conditions of a search, a zero value disables the condition.
+type Budget struct {
+	MaxIterations int
+	MaxDuration   time.Duration
+	// MaxAccepted stops the search after this many puzzles have been accepted
+	MaxAccepted int
+	// MaxStale stops the search after this many iterations without a puzzle being accepted
+	MaxStale int
+}
+
+func DefaultBudget() *Budget {
+	return &Budget{
+		MaxIterations: DEFAULT_MAX_ITERATIONS,
+	}
+}
+
+// Exhausted returns the reason the search should stop, or an empty string if it should continue.
+func (b *Budget) Exhausted(iteration int, elapsed time.Duration, accepted, improved int) string {
+	if b.MaxIterations > 0 && iteration >= b.MaxIterations {
+		return STOP_ITERATIONS
+	}
+	if b.MaxDuration > 0 && elapsed >= b.MaxDuration {
+		return STOP_DURATION
+	}
+	if b.MaxAccepted > 0 && accepted >= b.MaxAccepted {
+		return STOP_ACCEPTED
+	}
+	if b.MaxStale > 0 && iteration-improved >= b.MaxStale {
+		return STOP_STALE
+	}
+	return ""
+}
+
+// Search repeatedly generates and scores puzzles until its budget is exhausted.
+type Search struct {
+	Budget     *Budget
+	Checkpoint *Checkpoint
+	// CheckpointPath, if set, is where the checkpoint is periodically written
+	CheckpointPath string
+	Progress       *Progress
+	// Interrupt, if set, stops the search when it receives a signal
+	Interrupt <-chan os.Signal
+	// Generate creates a puzzle from the given seed
+	Generate func(seed int64) *perspectivego.Puzzle
+	// Score returns the score and penalty of the given puzzle
+	Score func(puzzle *perspectivego.Puzzle) (int, int)
+	// Accept is given each scored puzzle and returns true if it was kept, or ErrSearchComplete to stop the search
+	Accept func(iteration int, puzzle *perspectivego.Puzzle, score, penalty int) (bool, error)
+	start  time.Time
+}
+
+func NewSearch(budget *Budget, checkpoint *Checkpoint) *Search {
+	if budget == nil {
+		budget = DefaultBudget()
+	}
+	return &Search{
+		Budget:     budget,
+		Checkpoint: checkpoint,
+		start:      time.Now().Add(-checkpoint.Elapsed),
+	}
+}
+
+// Start returns the time the search started, adjusted for any time elapsed before it was resumed.
+func (s *Search) Start() time.Time {
+	return s.start
+}
+
+// Run runs the search and returns the reason it stopped.
+func (s *Search) Run() (string, error) {
+	c := s.Checkpoint
+	if s.Progress != nil {
+		s.Progress.Accepted = c.Accepted
+		s.Progress.Total = s.Budget.MaxIterations
+		if s.Budget.MaxDuration > 0 {
+			s.Progress.Deadline = s.start.Add(s.Budget.MaxDuration)
+		}
+	}
+	for {
+		if reason := s.Budget.Exhausted(c.Iteration, time.Since(s.start), c.Accepted, c.Improved); reason != "" {
+			return reason, s.Save()
+		}
+		if s.interrupted() {
+			return STOP_INTERRUPTED, s.Save()
+		}
+		if c.Iteration%CHECKPOINT_INTERVAL == 0 {
+			if err := s.Save(); err != nil {
+				return "", err
+			}
+		}
+		iteration := c.Iteration
+		puzzle := s.Generate(c.IterationSeed(iteration))
+		score, penalty := s.Score(puzzle)
+		if s.Progress != nil {
+			if err := s.Progress.Update(iteration, score, penalty); err != nil {
+				return "", err
+			}
+		}
+		accepted, err := s.Accept(iteration, puzzle, score, penalty)
+		c.Iteration++
+		if accepted {
+			c.Accepted++
+			c.Improved = c.Iteration
+			if s.Progress != nil {
+				s.Progress.Accept()
+			}
+		}
+		if err == ErrSearchComplete {
+			return STOP_COMPLETE, s.Save()
+		} else if err != nil {
+			return "", err
+		}
+		if accepted {
+			if err := s.Save(); err != nil {
+				return "", err
+			}
+		}
+	}
+}
+
+// Save writes the checkpoint to CheckpointPath, if set.
+func (s *Search) Save() error {
+	s.Checkpoint.Elapsed = time.Since(s.start)
+	if s.CheckpointPath == "" {
+		return nil
+	}
+	return WriteCheckpointFile(s.CheckpointPath, s.Checkpoint)
+}
+
+func (s *Search) interrupted() bool {
+	if s.Interrupt == nil {
+		return false
+	}
+	select {
+	case <-s.Interrupt:
+		return true
+	default:
+		return false
+	}
+}
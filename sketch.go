@@ -0,0 +1,455 @@
+/*
+ * Copyright 2019 Aletheia Ware LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package perspectiveeditorgo
+
+import (
+	"errors"
+	"fmt"
+	"github.com/AletheiaWareLLC/perspectivego"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+const (
+	// SKETCH_ATTEMPTS is the default number of layouts tried before giving up
+	SKETCH_ATTEMPTS = 100
+	// SKETCH_SOLUTIONS is the number of optimal solutions looked for when checking the sketched route is the only one
+	SKETCH_SOLUTIONS = 2
+	// SKETCH_BLOCKERS limits the decoy blocks placed to cut off competing routes in each layout
+	SKETCH_BLOCKERS = 64
+)
+
+// Sketch describes the route a designer wants the sphere to take, either as the cells it rests at or as the gravity direction of each roll.
+type Sketch struct {
+	// Stops are the cells the sphere rests at, from where it starts to the goal; consecutive stops which are not in line are joined through a pair of portals
+	Stops []*perspectivego.Location
+	// Directions are the gravity of each roll, used when there are no stops; the cells are then chosen backwards from a random goal
+	Directions []*perspectivego.Location
+	// Decoys is the number of extra blocks placed to distract from the route without changing it
+	Decoys int
+	// Attempts limits the number of layouts tried
+	Attempts int
+	Goal     *ElementStyle
+	Sphere   *ElementStyle
+	Block    *ElementStyle
+	Portal   *ElementStyle
+}
+
+// ParseSketch parses a route of stops, given as x,y,z locations, or of gravity direction names, separated by whitespace or semicolons.
+func ParseSketch(s string) (*Sketch, error) {
+	sketch := &Sketch{}
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool {
+		return r == ';' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	}) {
+		if strings.IndexAny(f, "-0123456789") < 0 {
+			moves, err := ParseDirections(f)
+			if err != nil {
+				return nil, err
+			}
+			sketch.Directions = append(sketch.Directions, moves...)
+			continue
+		}
+		parts := strings.Split(f, ",")
+		if len(parts) != 3 {
+			return nil, errors.New("Unrecognized stop: " + f)
+		}
+		var coordinates [3]int32
+		for i, p := range parts {
+			c, err := strconv.ParseInt(strings.TrimSpace(p), 10, 32)
+			if err != nil {
+				return nil, errors.New("Unrecognized stop: " + f)
+			}
+			coordinates[i] = int32(c)
+		}
+		sketch.Stops = append(sketch.Stops, locationOf(coordinates))
+	}
+	if len(sketch.Stops) > 0 && len(sketch.Directions) > 0 {
+		return nil, errors.New("Sketch must be either stops or directions, not both")
+	}
+	return sketch, nil
+}
+
+// Portals returns the number of pairs of portals the sketch needs, one for each pair of consecutive stops which are not in line.
+func (s *Sketch) Portals() int {
+	portals := 0
+	for i := 1; i < len(s.Stops); i++ {
+		if alignment(cellOf(s.Stops[i-1]), cellOf(s.Stops[i])) == nil {
+			portals++
+		}
+	}
+	return portals
+}
+
+// GenerateSketch lays out a puzzle within the volume so the sphere follows the sketched route, then adds decoy blocks so that route is the unique optimal solution.
+// A sketch of stops places a block beyond each stop, unless the wall bounds already stop the sphere there, and joins stops which are not in line through a pair of portals.
+// A sketch of directions is constructed backwards from a random goal as GenerateRetrograde does, with one block for each stop.
+// Decoy blocks are then placed across the first move of any competing optimal route found by OptimalSolutions until none remain, and the puzzle's target is set by ScoreBounds.
+func GenerateSketch(seed int64, puzzle *perspectivego.Puzzle, volume *Volume, bounds *Bounds, sketch *Sketch) (*perspectivego.Puzzle, []*Roll, error) {
+	for _, s := range []*ElementStyle{sketch.Goal, sketch.Sphere, sketch.Block} {
+		if s == nil || !s.Valid() {
+			return nil, nil, errors.New("Goal, sphere and block styles must each have a mesh, colour, texture and material")
+		}
+	}
+	if sketch.Decoys < 0 {
+		return nil, nil, errors.New("Decoys must not be negative")
+	}
+	extent, err := volume.Bounds(BOUNDS_FALL)
+	if err != nil {
+		return nil, nil, err
+	}
+	var moves []*perspectivego.Location
+	switch {
+	case len(sketch.Stops) > 0:
+		if len(sketch.Stops) < 2 {
+			return nil, nil, errors.New("Sketch must have a start and a goal")
+		}
+		var previous *perspectivego.Location
+		for i, s := range sketch.Stops {
+			if !extent.Contains(s) {
+				return nil, nil, fmt.Errorf("Stop %s outside volume %s", perspectivego.LocationToString(s), volume)
+			}
+			if i == 0 {
+				continue
+			}
+			if cellOf(s) == cellOf(sketch.Stops[i-1]) {
+				return nil, nil, fmt.Errorf("Stop %s is repeated", perspectivego.LocationToString(s))
+			}
+			d := alignment(cellOf(sketch.Stops[i-1]), cellOf(s))
+			if d != nil && previous != nil && !perpendicular(d, previous) {
+				return nil, nil, fmt.Errorf("Stop %s must turn at right angles", perspectivego.LocationToString(sketch.Stops[i-1]))
+			}
+			if block := locationOf(cellOf(s)); d != nil && i < len(sketch.Stops)-1 && bounds.Model != BOUNDS_WALL {
+				block.X += d.X
+				block.Y += d.Y
+				block.Z += d.Z
+				if !extent.Contains(block) {
+					return nil, nil, fmt.Errorf("Stop %s has no room for a block beyond it", perspectivego.LocationToString(s))
+				}
+			}
+			previous = d
+		}
+		if sketch.Portals() > 0 && (sketch.Portal == nil || !sketch.Portal.Valid()) {
+			return nil, nil, errors.New("Portal style must have a mesh, colour, texture and material")
+		}
+	case len(sketch.Directions) > 0:
+		for i := 1; i < len(sketch.Directions); i++ {
+			if !perpendicular(sketch.Directions[i-1], sketch.Directions[i]) {
+				return nil, nil, fmt.Errorf("Direction %d must turn at right angles", i)
+			}
+		}
+		moves = sketch.Directions
+	default:
+		return nil, nil, errors.New("Sketch has no route")
+	}
+	attempts := sketch.Attempts
+	if attempts <= 0 {
+		attempts = SKETCH_ATTEMPTS
+	}
+	styles := &Retrograde{
+		Goal:   sketch.Goal,
+		Sphere: sketch.Sphere,
+		Block:  sketch.Block,
+		Portal: sketch.Portal,
+	}
+	rand.Seed(seed)
+	for attempt := 0; attempt < attempts; attempt++ {
+		c, err := newConstruction(volume, bounds)
+		if err != nil {
+			return nil, nil, err
+		}
+		if moves == nil {
+			if !c.layout(sketch.Stops) {
+				continue
+			}
+		} else {
+			c.fixed = moves
+			if !c.build(len(moves)-1, 0) {
+				continue
+			}
+		}
+		candidate := c.isolate(puzzle, styles)
+		if candidate == nil {
+			continue
+		}
+		candidate = c.decoy(puzzle, styles, candidate, sketch.Decoys)
+		rotations := SolutionRotations(c.moves())
+		r, _ := ScoreBounds(candidate, bounds)
+		if r < rotations {
+			continue
+		}
+		candidate.Target = uint32(r)
+		return candidate, c.rolls, nil
+	}
+	return nil, nil, fmt.Errorf("No layout making the sketch the unique optimal route was found in %d attempts", attempts)
+}
+
+// alignment returns the direction leading from one cell to the other, or nil if they are not in line along an axis.
+func alignment(from, to cell) *perspectivego.Location {
+	for _, d := range directions {
+		k := int32(0)
+		for i, c := range [3]int32{d.X, d.Y, d.Z} {
+			if c != 0 {
+				k = (to[i] - from[i]) * c
+			}
+		}
+		if k > 0 && to == (cell{from[0] + k*d.X, from[1] + k*d.Y, from[2] + k*d.Z}) {
+			return d
+		}
+	}
+	return nil
+}
+
+// layout reserves the cells for a roll between each pair of consecutive stops, returning false if they conflict.
+func (c *construction) layout(stops []*perspectivego.Location) bool {
+	c.goal = cellOf(stops[len(stops)-1])
+	c.cells[c.goal] = RETROGRADE_GOAL
+	c.commit(map[cell]int{cellOf(stops[0]): RETROGRADE_PATH}, nil)
+	var previous *perspectivego.Location
+	for i := 0; i+1 < len(stops); i++ {
+		from, to := cellOf(stops[i]), cellOf(stops[i+1])
+		roll := &Roll{
+			From: stops[i],
+			To:   stops[i+1],
+		}
+		reserved := make(map[cell]int)
+		var pair *[2]cell
+		if d := alignment(from, to); d != nil {
+			roll.Direction = d
+			if !c.path(from, to, d, reserved) {
+				return false
+			}
+		} else {
+			var next *perspectivego.Location
+			if i+2 < len(stops) {
+				next = alignment(to, cellOf(stops[i+2]))
+			}
+			for _, k := range rand.Perm(len(directions)) {
+				d := directions[k]
+				if (previous != nil && !perpendicular(d, previous)) || (next != nil && !perpendicular(d, next)) {
+					continue
+				}
+				r := make(map[cell]int)
+				if p := c.route(from, to, d, r); p != nil {
+					roll.Direction = d
+					roll.Entrance = locationOf(p[0])
+					roll.Exit = locationOf(p[1])
+					reserved = r
+					pair = p
+					break
+				}
+			}
+			if pair == nil {
+				return false
+			}
+		}
+		if i+2 < len(stops) {
+			// The sphere rests at the stop against a block, or against the wall
+			block := c.step(to, roll.Direction, 1)
+			if c.inside(block) {
+				if !c.available(block, RETROGRADE_BLOCK, reserved) {
+					return false
+				}
+				reserved[block] = RETROGRADE_BLOCK
+			} else if c.bounds.Model != BOUNDS_WALL {
+				return false
+			}
+		}
+		c.commit(reserved, pair)
+		c.rolls = append(c.rolls, roll)
+		previous = roll.Direction
+	}
+	return true
+}
+
+// path reserves the cells rolled through from one cell to the other in the given direction, returning false if any is taken.
+func (c *construction) path(from, to cell, direction *perspectivego.Location, reserved map[cell]int) bool {
+	for x := c.step(from, direction, 1); ; x = c.step(x, direction, 1) {
+		if x != c.goal {
+			if !c.available(x, RETROGRADE_PATH, reserved) {
+				return false
+			}
+			if reserved[x] == 0 {
+				reserved[x] = RETROGRADE_PATH
+			}
+		}
+		if x == to {
+			return true
+		}
+	}
+}
+
+// route reserves a roll from one cell into a portal, leaving its pair in line with the other cell, in the given direction.
+// It returns the entrance and exit, chosen at random from the free cells, or nil if there are none.
+func (c *construction) route(from, to cell, direction *perspectivego.Location, reserved map[cell]int) *[2]cell {
+	var entrances []cell
+	for k := 1; ; k++ {
+		x := c.step(from, direction, k)
+		if !c.inside(x) {
+			break
+		}
+		if c.cells[x] == 0 {
+			entrances = append(entrances, x)
+		}
+		if !c.available(x, RETROGRADE_PATH, reserved) {
+			break
+		}
+	}
+	var exits []cell
+	for k := 1; ; k++ {
+		x := c.step(to, direction, -k)
+		if !c.inside(x) {
+			break
+		}
+		if c.cells[x] == 0 {
+			exits = append(exits, x)
+		}
+		if !c.available(x, RETROGRADE_PATH, reserved) {
+			break
+		}
+	}
+	if len(entrances) == 0 || len(exits) == 0 {
+		return nil
+	}
+	entrance := entrances[rand.Intn(len(entrances))]
+	exit := exits[rand.Intn(len(exits))]
+	if entrance == exit {
+		return nil
+	}
+	if entrance != c.step(from, direction, 1) && !c.path(from, c.step(entrance, direction, -1), direction, reserved) {
+		return nil
+	}
+	if !c.path(exit, to, direction, reserved) {
+		return nil
+	}
+	if reserved[entrance] != 0 || reserved[exit] != 0 {
+		return nil
+	}
+	reserved[entrance] = RETROGRADE_PORTAL
+	reserved[exit] = RETROGRADE_PORTAL
+	return &[2]cell{entrance, exit}
+}
+
+// moves returns the direction of each roll.
+func (c *construction) moves() []*perspectivego.Location {
+	var moves []*perspectivego.Location
+	for _, r := range c.rolls {
+		moves = append(moves, r.Direction)
+	}
+	return moves
+}
+
+// follows returns true if the sphere in the puzzle takes the construction's rolls, resting where each ends and reaching the goal with the last.
+func (c *construction) follows(puzzle *perspectivego.Puzzle) bool {
+	simulation := NewBoundedSimulation(puzzle, c.bounds)
+	portaled := false
+	for i, r := range c.rolls {
+		location, _, p, _, outcome := simulation.Walk(r.From, r.Direction, portaled)
+		portaled = p
+		expected := WALK_REST
+		if i == len(c.rolls)-1 {
+			expected = WALK_GOAL
+		}
+		if outcome != expected || cellOf(location) != cellOf(r.To) {
+			return false
+		}
+	}
+	return true
+}
+
+// unique returns true if the puzzle's only optimal solution is the construction's rolls.
+func (c *construction) unique(puzzle *perspectivego.Puzzle) bool {
+	solutions := OptimalSolutions(puzzle, c.bounds, SKETCH_SOLUTIONS)
+	return len(solutions) == 1 && equalMoves(solutions[0], c.moves())
+}
+
+// isolate builds the puzzle, placing decoy blocks across the first move of each competing optimal route, and returns nil if the rolls do not become the unique optimal solution.
+func (c *construction) isolate(template *perspectivego.Puzzle, styles *Retrograde) *perspectivego.Puzzle {
+	moves := c.moves()
+	for blockers := 0; ; blockers++ {
+		puzzle := c.puzzle(template, styles)
+		var competitor []*perspectivego.Location
+		for _, s := range OptimalSolutions(puzzle, c.bounds, SKETCH_SOLUTIONS) {
+			if !equalMoves(s, moves) {
+				competitor = s
+				break
+			}
+		}
+		if competitor == nil {
+			if !c.follows(puzzle) || !c.unique(puzzle) {
+				return nil
+			}
+			return puzzle
+		}
+		if blockers >= SKETCH_BLOCKERS {
+			return nil
+		}
+		// Find where the competitor leaves the route
+		j := 0
+		for j < len(competitor) && j < len(moves) && competitor[j] == moves[j] {
+			j++
+		}
+		if j >= len(competitor) || j >= len(moves) {
+			return nil
+		}
+		var candidates []cell
+		for x := c.step(cellOf(c.rolls[j].From), competitor[j], 1); c.inside(x); x = c.step(x, competitor[j], 1) {
+			if role := c.cells[x]; role == 0 {
+				candidates = append(candidates, x)
+			} else if role != RETROGRADE_PATH {
+				break
+			}
+		}
+		if len(candidates) == 0 {
+			return nil
+		}
+		c.commit(map[cell]int{candidates[rand.Intn(len(candidates))]: RETROGRADE_BLOCK}, nil)
+	}
+}
+
+// decoy adds up to the given number of blocks in free cells, keeping only those which leave the rolls the unique optimal solution, and returns the puzzle.
+func (c *construction) decoy(template *perspectivego.Puzzle, styles *Retrograde, puzzle *perspectivego.Puzzle, decoys int) *perspectivego.Puzzle {
+	for placed, tries := 0, 0; placed < decoys && tries < decoys*RETROGRADE_CHOICES; tries++ {
+		x := c.randomCell()
+		if c.cells[x] != 0 {
+			continue
+		}
+		c.cells[x] = RETROGRADE_BLOCK
+		c.blocks = append(c.blocks, x)
+		candidate := c.puzzle(template, styles)
+		if !c.unique(candidate) {
+			delete(c.cells, x)
+			c.blocks = c.blocks[:len(c.blocks)-1]
+			continue
+		}
+		puzzle = candidate
+		placed++
+	}
+	return puzzle
+}
+
+func equalMoves(a, b []*perspectivego.Location) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright 2019 Aletheia Ware LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package perspectiveeditorgo
+
+import (
+	"github.com/AletheiaWareLLC/perspectivego"
+	"testing"
+)
+
+func TestGenerateSketchUniqueOptimum(t *testing.T) {
+	volume := CubeVolume(5)
+	for _, test := range []struct {
+		model  string
+		sketch string
+	}{
+		{BOUNDS_WALL, "0,2,0; 0,-2,0; 2,-2,0; 1,1,1"},
+		{BOUNDS_FALL, "0,1,0; 0,-1,0; 1,-1,0; 1,-1,1"},
+		{BOUNDS_FALL, "down left backward up right"},
+		{BOUNDS_WALL, "down forward left"},
+	} {
+		bounds, err := volume.Bounds(test.model)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, decoys := range []int{0, 3} {
+			for seed := int64(0); seed < 4; seed++ {
+				sketch, err := ParseSketch(test.sketch)
+				if err != nil {
+					t.Fatal(err)
+				}
+				sketch.Decoys = decoys
+				sketch.Goal = testStyle()
+				sketch.Sphere = testStyle()
+				sketch.Block = testStyle()
+				sketch.Portal = testStyle()
+				puzzle, rolls, err := GenerateSketch(seed, &perspectivego.Puzzle{}, volume, bounds, sketch)
+				if err != nil {
+					t.Fatalf("%s %q decoys %d seed %d: %v", test.model, test.sketch, decoys, seed, err)
+				}
+				moves := rollDirections(rolls)
+				if len(sketch.Directions) > 0 && !equalMoves(moves, sketch.Directions) {
+					t.Fatalf("%s %q decoys %d seed %d: rolled %v", test.model, test.sketch, decoys, seed, moves)
+				}
+				for i, s := range sketch.Stops {
+					if i < len(rolls) && cellOf(rolls[i].From) != cellOf(s) || i > 0 && cellOf(rolls[i-1].To) != cellOf(s) {
+						t.Fatalf("%s %q decoys %d seed %d: roll %d does not follow the stops", test.model, test.sketch, decoys, seed, i)
+					}
+				}
+				solutions := OptimalSolutions(puzzle, bounds, 2)
+				if len(solutions) != 1 || !equalMoves(solutions[0], moves) {
+					t.Fatalf("%s %q decoys %d seed %d: expected the only optimal solution to be %v, got %v", test.model, test.sketch, decoys, seed, moves, solutions)
+				}
+			}
+		}
+	}
+}
+
+func TestGenerateSketchRejectsNegativeDecoys(t *testing.T) {
+	sketch, err := ParseSketch("down left")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sketch.Decoys = -1
+	sketch.Goal = testStyle()
+	sketch.Sphere = testStyle()
+	sketch.Block = testStyle()
+	if _, _, err := GenerateSketch(0, &perspectivego.Puzzle{}, CubeVolume(5), LegacyBounds(5), sketch); err == nil {
+		t.Fatal("Expected an error")
+	}
+}
@@ -0,0 +1,504 @@
+/*
+ * Copyright 2019 Aletheia Ware LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package perspectiveeditorgo
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/AletheiaWareLLC/perspectivego"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A slice file describes a puzzle as one grid of characters per Z layer:
+//
+//	// Comments start with two slashes
+//	size:3
+//	target:2
+//	description:...
+//	outline:<mesh>:<colour>:<texture>:<material>:<shader>
+//	block:<mesh...>:<colour...>:<texture...>:<material...>:<shader>
+//	z:-1
+//	#.A
+//	...
+//	@..
+//	z:1
+//	a.*
+//	...
+//	...
+//
+// Each grid has size rows of size characters, with the top row at the highest Y and the left column at the lowest X.
+// Layers without a z line are empty, and each uppercase portal letter is linked to the matching lowercase letter.
+// The goal, sphere, block and portal lines override the default style of each element, with lists separated by commas as in Generate.
+const (
+	SLICE_EMPTY   = '.'
+	SLICE_BLOCK   = '#'
+	SLICE_GOAL    = '*'
+	SLICE_SPHERE  = '@'
+	SLICE_COMMENT = "//"
+)
+
+// SliceStyle holds the appearance given to elements read from a slice file.
+type SliceStyle struct {
+	Outline *perspectivego.Outline
+	Goal    *ElementStyle
+	Sphere  *ElementStyle
+	Block   *ElementStyle
+	Portal  *ElementStyle
+}
+
+func DefaultSliceStyle() *SliceStyle {
+	return &SliceStyle{
+		Outline: &perspectivego.Outline{
+			Mesh:     "box",
+			Colour:   "white",
+			Material: "main",
+			Shader:   "main",
+		},
+		Goal: &ElementStyle{
+			Mesh:     []string{"box"},
+			Colour:   []string{"green"},
+			Texture:  []string{""},
+			Material: []string{"main"},
+			Shader:   "main",
+		},
+		Sphere: &ElementStyle{
+			Mesh:     []string{"sphere"},
+			Colour:   []string{"white"},
+			Texture:  []string{""},
+			Material: []string{"main"},
+			Shader:   "main",
+		},
+		Block: &ElementStyle{
+			Mesh:     []string{"box"},
+			Colour:   []string{"grey"},
+			Texture:  []string{""},
+			Material: []string{"main"},
+			Shader:   "main",
+		},
+		Portal: &ElementStyle{
+			Mesh:     []string{"box"},
+			Colour:   []string{"orange", "purple", "cyan", "pink"},
+			Texture:  []string{""},
+			Material: []string{"main"},
+			Shader:   "main",
+		},
+	}
+}
+
+// ReadSlices parses a slice file, using the given style for any element kind the file does not style itself.
+func ReadSlices(reader io.Reader, style *SliceStyle) (*perspectivego.Puzzle, uint32, error) {
+	if style == nil {
+		style = DefaultSliceStyle()
+	}
+	s := *style
+	puzzle := &perspectivego.Puzzle{
+		Outline: s.Outline,
+	}
+	var size uint32
+	layers := make(map[int32][]string)
+	var order []int32
+	scanner := bufio.NewScanner(reader)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimRight(scanner.Text(), " \t\r")
+		if text == "" || strings.HasPrefix(text, SLICE_COMMENT) {
+			continue
+		}
+		parts := strings.SplitN(text, ":", 2)
+		if len(parts) == 2 {
+			var err error
+			switch parts[0] {
+			case "size":
+				var v uint64
+				v, err = strconv.ParseUint(parts[1], 10, 32)
+				size = uint32(v)
+			case "target":
+				var v uint64
+				v, err = strconv.ParseUint(parts[1], 10, 32)
+				puzzle.Target = uint32(v)
+			case "description":
+				puzzle.Description = parts[1]
+			case "outline":
+				o := strings.Split(parts[1], ":")
+				if len(o) != 5 {
+					err = errors.New("Malformed outline")
+				} else {
+					puzzle.Outline = &perspectivego.Outline{
+						Mesh:     o[0],
+						Colour:   o[1],
+						Texture:  o[2],
+						Material: o[3],
+						Shader:   o[4],
+					}
+				}
+			case "goal":
+				s.Goal, err = ParseElementStyle(parts[1])
+			case "sphere":
+				s.Sphere, err = ParseElementStyle(parts[1])
+			case "block":
+				s.Block, err = ParseElementStyle(parts[1])
+			case "portal":
+				s.Portal, err = ParseElementStyle(parts[1])
+			case "z":
+				var v int64
+				v, err = strconv.ParseInt(parts[1], 10, 32)
+				if err == nil {
+					z := int32(v)
+					if _, ok := layers[z]; ok {
+						err = errors.New("Duplicate layer")
+					} else {
+						layers[z] = nil
+						order = append(order, z)
+					}
+				}
+			default:
+				err = errors.New("Unrecognized line")
+			}
+			if err != nil {
+				return nil, 0, fmt.Errorf("Line %d: %s", line, err)
+			}
+			continue
+		}
+		if len(order) == 0 {
+			return nil, 0, fmt.Errorf("Line %d: Row before first layer", line)
+		}
+		z := order[len(order)-1]
+		layers[z] = append(layers[z], text)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+	if size == 0 {
+		return nil, 0, errors.New("Missing size")
+	}
+	for _, e := range []*ElementStyle{s.Goal, s.Sphere, s.Block, s.Portal} {
+		if e == nil || !e.Valid() {
+			return nil, 0, errors.New("Missing element style")
+		}
+	}
+
+	half := int32(size / 2)
+	min, max := -half, int32(size)-half-1
+	sort.Slice(order, func(i, j int) bool {
+		return order[i] < order[j]
+	})
+	portals := make(map[rune][]*perspectivego.Location)
+	for _, z := range order {
+		rows := layers[z]
+		if z < min || z > max {
+			return nil, 0, fmt.Errorf("Layer %d outside world of size %d", z, size)
+		}
+		if len(rows) != int(size) {
+			return nil, 0, fmt.Errorf("Layer %d has %d rows, expected %d", z, len(rows), size)
+		}
+		for r, row := range rows {
+			cells := []rune(row)
+			if len(cells) != int(size) {
+				return nil, 0, fmt.Errorf("Layer %d row %d has %d columns, expected %d", z, r, len(cells), size)
+			}
+			for c, cell := range cells {
+				location := &perspectivego.Location{
+					X: int32(c) - half,
+					Y: max - int32(r),
+					Z: z,
+				}
+				switch {
+				case cell == SLICE_EMPTY:
+				case cell == SLICE_BLOCK:
+					i := len(puzzle.Block)
+					puzzle.Block = append(puzzle.Block, &perspectivego.Block{
+						Name:     "b" + strconv.Itoa(i),
+						Mesh:     s.Block.Mesh[i%len(s.Block.Mesh)],
+						Colour:   s.Block.Colour[i%len(s.Block.Colour)],
+						Location: location,
+						Texture:  s.Block.Texture[i%len(s.Block.Texture)],
+						Material: s.Block.Material[i%len(s.Block.Material)],
+						Shader:   s.Block.Shader,
+					})
+				case cell == SLICE_GOAL:
+					i := len(puzzle.Goal)
+					puzzle.Goal = append(puzzle.Goal, &perspectivego.Goal{
+						Name:     "g" + strconv.Itoa(i),
+						Mesh:     s.Goal.Mesh[i%len(s.Goal.Mesh)],
+						Colour:   s.Goal.Colour[i%len(s.Goal.Colour)],
+						Location: location,
+						Texture:  s.Goal.Texture[i%len(s.Goal.Texture)],
+						Material: s.Goal.Material[i%len(s.Goal.Material)],
+						Shader:   s.Goal.Shader,
+					})
+				case cell == SLICE_SPHERE:
+					i := len(puzzle.Sphere)
+					puzzle.Sphere = append(puzzle.Sphere, &perspectivego.Sphere{
+						Name:     "s" + strconv.Itoa(i),
+						Mesh:     s.Sphere.Mesh[i%len(s.Sphere.Mesh)],
+						Colour:   s.Sphere.Colour[i%len(s.Sphere.Colour)],
+						Location: location,
+						Texture:  s.Sphere.Texture[i%len(s.Sphere.Texture)],
+						Material: s.Sphere.Material[i%len(s.Sphere.Material)],
+						Shader:   s.Sphere.Shader,
+					})
+				case cell >= 'A' && cell <= 'Z', cell >= 'a' && cell <= 'z':
+					if len(portals[cell]) > 0 {
+						return nil, 0, fmt.Errorf("Duplicate portal: %c", cell)
+					}
+					portals[cell] = append(portals[cell], location)
+				default:
+					return nil, 0, fmt.Errorf("Layer %d row %d has unrecognized cell: %c", z, r, cell)
+				}
+			}
+		}
+	}
+	for label := 'A'; label <= 'Z'; label++ {
+		lower := label - 'A' + 'a'
+		a, b := portals[label], portals[lower]
+		if len(a) == 0 && len(b) == 0 {
+			continue
+		}
+		if len(a) == 0 || len(b) == 0 {
+			return nil, 0, fmt.Errorf("Unpaired portal: %c", label)
+		}
+		for _, l := range [][2]*perspectivego.Location{{a[0], b[0]}, {b[0], a[0]}} {
+			i := len(puzzle.Portal)
+			puzzle.Portal = append(puzzle.Portal, &perspectivego.Portal{
+				Name:     "p" + strconv.Itoa(i),
+				Mesh:     s.Portal.Mesh[i%len(s.Portal.Mesh)],
+				Colour:   s.Portal.Colour[(i/2)%len(s.Portal.Colour)],
+				Location: l[0],
+				Link:     l[1],
+				Texture:  s.Portal.Texture[(i/2)%len(s.Portal.Texture)],
+				Material: s.Portal.Material[(i/2)%len(s.Portal.Material)],
+				Shader:   s.Portal.Shader,
+			})
+		}
+	}
+	return puzzle, size, nil
+}
+
+// WriteSlices writes the puzzle as a slice file, with only the non-empty layers.
+// Styles are listed in the order ReadSlices reads the cells back, so each element keeps its mesh, colour, texture and material,
+// except that both portals of a pair take the colour, texture and material of the first. Each element kind takes the shader of
+// its first element in that order, names are not preserved, and portals must be linked in mutual pairs.
+func WriteSlices(writer io.Writer, puzzle *perspectivego.Puzzle, size uint32) error {
+	half := int32(size / 2)
+	min, max := -half, int32(size)-half-1
+	cells := make(map[string]rune)
+	set := func(l *perspectivego.Location, cell rune) error {
+		if l.X < min || l.X > max || l.Y < min || l.Y > max || l.Z < min || l.Z > max {
+			return fmt.Errorf("Location %s outside world of size %d", perspectivego.LocationToString(l), size)
+		}
+		k := l.String()
+		if c, ok := cells[k]; ok {
+			return fmt.Errorf("Location %s has both %c and %c", perspectivego.LocationToString(l), c, cell)
+		}
+		cells[k] = cell
+		return nil
+	}
+	for _, b := range puzzle.Block {
+		if err := set(b.Location, SLICE_BLOCK); err != nil {
+			return err
+		}
+	}
+	for _, g := range puzzle.Goal {
+		if err := set(g.Location, SLICE_GOAL); err != nil {
+			return err
+		}
+	}
+	for _, s := range puzzle.Sphere {
+		if err := set(s.Location, SLICE_SPHERE); err != nil {
+			return err
+		}
+	}
+	labelled := make(map[int]bool)
+	label := 'A'
+	for i, p := range puzzle.Portal {
+		if labelled[i] {
+			continue
+		}
+		pair := -1
+		for j := i + 1; j < len(puzzle.Portal); j++ {
+			o := puzzle.Portal[j]
+			if !labelled[j] && p.Link.String() == o.Location.String() && o.Link.String() == p.Location.String() {
+				pair = j
+				break
+			}
+		}
+		if pair < 0 {
+			return errors.New("Portal not linked in a pair: " + p.Name)
+		}
+		if label > 'Z' {
+			return errors.New("Too many portal pairs")
+		}
+		if err := set(p.Location, label); err != nil {
+			return err
+		}
+		if err := set(puzzle.Portal[pair].Location, label-'A'+'a'); err != nil {
+			return err
+		}
+		labelled[i] = true
+		labelled[pair] = true
+		label++
+	}
+
+	fmt.Fprintln(writer, "size:"+fmt.Sprint(size))
+	fmt.Fprintln(writer, "target:"+fmt.Sprint(puzzle.Target))
+	if puzzle.Description != "" {
+		fmt.Fprintln(writer, "description:"+puzzle.Description)
+	}
+	if o := puzzle.Outline; o != nil {
+		fmt.Fprintln(writer, "outline:"+o.Mesh+":"+o.Colour+":"+o.Texture+":"+o.Material+":"+o.Shader)
+	}
+	// Goals, spheres and blocks are styled in the order they are read back, which is by layer, then row from the top, then column
+	goalOrder := append([]*perspectivego.Goal{}, puzzle.Goal...)
+	sort.SliceStable(goalOrder, func(i, j int) bool {
+		return scansBefore(goalOrder[i].Location, goalOrder[j].Location)
+	})
+	sphereOrder := append([]*perspectivego.Sphere{}, puzzle.Sphere...)
+	sort.SliceStable(sphereOrder, func(i, j int) bool {
+		return scansBefore(sphereOrder[i].Location, sphereOrder[j].Location)
+	})
+	blockOrder := append([]*perspectivego.Block{}, puzzle.Block...)
+	sort.SliceStable(blockOrder, func(i, j int) bool {
+		return scansBefore(blockOrder[i].Location, blockOrder[j].Location)
+	})
+	var goals, spheres, blocks, portals [][4]string
+	for _, g := range goalOrder {
+		goals = append(goals, [4]string{g.Mesh, g.Colour, g.Texture, g.Material})
+	}
+	for _, s := range sphereOrder {
+		spheres = append(spheres, [4]string{s.Mesh, s.Colour, s.Texture, s.Material})
+	}
+	for _, b := range blockOrder {
+		blocks = append(blocks, [4]string{b.Mesh, b.Colour, b.Texture, b.Material})
+	}
+	if len(goalOrder) > 0 {
+		fmt.Fprintln(writer, "goal:"+styleString(goals, false, goalOrder[0].Shader))
+	}
+	if len(sphereOrder) > 0 {
+		fmt.Fprintln(writer, "sphere:"+styleString(spheres, false, sphereOrder[0].Shader))
+	}
+	if len(blockOrder) > 0 {
+		fmt.Fprintln(writer, "block:"+styleString(blocks, false, blockOrder[0].Shader))
+	}
+	if len(puzzle.Portal) > 0 {
+		// Portals are styled in the order they are read back, which is by label
+		ordered := make([]*perspectivego.Portal, len(puzzle.Portal))
+		for _, p := range puzzle.Portal {
+			c := cells[p.Location.String()]
+			index := 2 * int(c-'A')
+			if c >= 'a' {
+				index = 2*int(c-'a') + 1
+			}
+			ordered[index] = p
+		}
+		for _, p := range ordered {
+			portals = append(portals, [4]string{p.Mesh, p.Colour, p.Texture, p.Material})
+		}
+		fmt.Fprintln(writer, "portal:"+styleString(portals, true, ordered[0].Shader))
+	}
+	for z := min; z <= max; z++ {
+		var rows []string
+		empty := true
+		for y := max; y >= min; y-- {
+			row := make([]rune, 0, size)
+			for x := min; x <= max; x++ {
+				l := &perspectivego.Location{X: x, Y: y, Z: z}
+				if c, ok := cells[l.String()]; ok {
+					row = append(row, c)
+					empty = false
+				} else {
+					row = append(row, SLICE_EMPTY)
+				}
+			}
+			rows = append(rows, string(row))
+		}
+		if empty {
+			continue
+		}
+		fmt.Fprintln(writer, "z:"+fmt.Sprint(z))
+		for _, r := range rows {
+			fmt.Fprintln(writer, r)
+		}
+	}
+	return nil
+}
+
+// scansBefore returns true if ReadSlices reaches the first location before the second.
+func scansBefore(a, b *perspectivego.Location) bool {
+	if a.Z != b.Z {
+		return a.Z < b.Z
+	}
+	if a.Y != b.Y {
+		return a.Y > b.Y
+	}
+	return a.X < b.X
+}
+
+// styleString returns the shortest element style that reproduces the given mesh, colour, texture and material of each element.
+func styleString(values [][4]string, paired bool, shader string) string {
+	var lists []string
+	for a := 0; a < 4; a++ {
+		var column []string
+		for i, v := range values {
+			// Portal attributes other than mesh advance once per pair
+			if paired && a > 0 {
+				if i%2 == 1 {
+					continue
+				}
+			}
+			column = append(column, v[a])
+		}
+		lists = append(lists, strings.Join(cycle(column), ","))
+	}
+	return strings.Join(lists, ":") + ":" + shader
+}
+
+// cycle returns the shortest prefix of values which, when repeated, produces values.
+func cycle(values []string) []string {
+	for n := 1; n < len(values); n++ {
+		repeats := true
+		for i := n; i < len(values); i++ {
+			if values[i] != values[i%n] {
+				repeats = false
+				break
+			}
+		}
+		if repeats {
+			return values[:n]
+		}
+	}
+	return values
+}
+
+// ParseElementStyle parses <mesh...>:<colour...>:<texture...>:<material...>:<shader>, where each list is separated by commas.
+func ParseElementStyle(s string) (*ElementStyle, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 5 {
+		return nil, errors.New("Malformed element style")
+	}
+	return &ElementStyle{
+		Mesh:     strings.Split(parts[0], ","),
+		Colour:   strings.Split(parts[1], ","),
+		Texture:  strings.Split(parts[2], ","),
+		Material: strings.Split(parts[3], ","),
+		Shader:   parts[4],
+	}, nil
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright 2019 Aletheia Ware LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package perspectiveeditorgo
+
+import (
+	"bytes"
+	"github.com/AletheiaWareLLC/perspectivego"
+	"testing"
+)
+
+func TestSlicesRoundTrip(t *testing.T) {
+	puzzle := &perspectivego.Puzzle{
+		Target: 3,
+	}
+	colours := []string{"red", "black", "white", "blue", "green", "yellow"}
+	locations := []*perspectivego.Location{
+		{X: -2, Y: 0, Z: 2},
+		{X: 1, Y: 2, Z: -1},
+		{X: 0, Y: -2, Z: 0},
+		{X: 2, Y: 2, Z: 2},
+		{X: -1, Y: 1, Z: -2},
+		{X: 0, Y: 0, Z: 1},
+	}
+	for i, l := range locations {
+		puzzle.Block = append(puzzle.Block, &perspectivego.Block{
+			Name:     "b" + colours[i],
+			Mesh:     "box",
+			Colour:   colours[i],
+			Location: l,
+			Texture:  "grid" + colours[i],
+			Material: "plastic",
+			Shader:   "main",
+		})
+	}
+	for i, l := range []*perspectivego.Location{{X: 2, Y: -2, Z: 2}, {X: -2, Y: -2, Z: -2}} {
+		puzzle.Goal = append(puzzle.Goal, &perspectivego.Goal{
+			Name:     "g" + colours[i],
+			Mesh:     "goal",
+			Colour:   colours[i],
+			Location: l,
+			Texture:  "goal",
+			Material: "glow",
+			Shader:   "main",
+		})
+	}
+	puzzle.Sphere = append(puzzle.Sphere, &perspectivego.Sphere{
+		Name:     "s0",
+		Mesh:     "sphere",
+		Colour:   "white",
+		Location: &perspectivego.Location{X: 0, Y: 2, Z: 0},
+		Texture:  "sphere",
+		Material: "metal",
+		Shader:   "main",
+	})
+	a := &perspectivego.Location{X: 1, Y: 0, Z: 2}
+	b := &perspectivego.Location{X: -1, Y: -1, Z: -1}
+	for _, l := range [][2]*perspectivego.Location{{a, b}, {b, a}} {
+		puzzle.Portal = append(puzzle.Portal, &perspectivego.Portal{
+			Name:     "p",
+			Mesh:     "portal",
+			Colour:   "blue",
+			Location: l[0],
+			Link:     l[1],
+			Texture:  "portal",
+			Material: "glass",
+			Shader:   "main",
+		})
+	}
+
+	var buffer bytes.Buffer
+	if err := WriteSlices(&buffer, puzzle, 5); err != nil {
+		t.Fatal(err)
+	}
+	result, size, err := ReadSlices(&buffer, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 5 || result.Target != puzzle.Target {
+		t.Fatalf("Expected size 5 target %d, got size %d target %d", puzzle.Target, size, result.Target)
+	}
+	type appearance struct {
+		Mesh, Colour, Texture, Material string
+	}
+	collect := func(p *perspectivego.Puzzle) map[string]appearance {
+		elements := make(map[string]appearance)
+		for _, e := range p.Block {
+			elements["block"+e.Location.String()] = appearance{e.Mesh, e.Colour, e.Texture, e.Material}
+		}
+		for _, e := range p.Goal {
+			elements["goal"+e.Location.String()] = appearance{e.Mesh, e.Colour, e.Texture, e.Material}
+		}
+		for _, e := range p.Sphere {
+			elements["sphere"+e.Location.String()] = appearance{e.Mesh, e.Colour, e.Texture, e.Material}
+		}
+		for _, e := range p.Portal {
+			elements["portal"+e.Location.String()+e.Link.String()] = appearance{e.Mesh, e.Colour, e.Texture, e.Material}
+		}
+		return elements
+	}
+	expected, actual := collect(puzzle), collect(result)
+	if len(expected) != len(actual) {
+		t.Fatalf("Expected %d elements, got %d", len(expected), len(actual))
+	}
+	for k, e := range expected {
+		if a, ok := actual[k]; !ok || a != e {
+			t.Errorf("%s: expected %v, got %v", k, e, a)
+		}
+	}
+}
@@ -0,0 +1,471 @@
+/*
+ * Copyright 2019 Aletheia Ware LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package perspectiveeditorgo
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/AletheiaWareLLC/joygo"
+	"github.com/AletheiaWareLLC/perspectivego"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/encoding/protowire"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// An unpacked world is a directory containing a manifest, a puzzles directory and a shaders directory.
+//
+// The manifest lists the world attributes, then the shaders and puzzles in the order they are encoded in the world file:
+//
+//	name:<name>
+//	title:<title>
+//	size:<size>
+//	foreground:<colour>
+//	background:<colour>
+//	shader:<name>
+//	attribute:<attribute>
+//	uniform:<uniform>
+//	puzzle:<file>
+//
+// Each shader line is followed by one line per attribute and uniform.
+// Each shader has its source in shaders/<name>.vert and shaders/<name>.frag, and each puzzle is in the perspectivego text format, or JSON if the text format cannot represent it.
+const (
+	MANIFEST_FILE     = "world.txt"
+	PUZZLES_DIRECTORY = "puzzles"
+	SHADERS_DIRECTORY = "shaders"
+)
+
+const (
+	worldShaderField = 6
+)
+
+// ReadWorldData reads the encoded world from the given file, without the size prefix.
+func ReadWorldData(path string) ([]byte, error) {
+	buffer, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	size, s := proto.DecodeVarint(buffer)
+	if s <= 0 {
+		return nil, errors.New("Could not read size")
+	}
+	if s+int(size) > len(buffer) {
+		return nil, errors.New("Truncated world")
+	}
+	return buffer[s : s+int(size)], nil
+}
+
+// WriteWorldData writes the encoded world with its size prefix.
+func WriteWorldData(writer io.Writer, data []byte) error {
+	if _, err := writer.Write(proto.EncodeVarint(uint64(len(data)))); err != nil {
+		return err
+	}
+	_, err := writer.Write(data)
+	return err
+}
+
+// ShaderOrder returns the names of the shaders in the order they are encoded in the given world data.
+func ShaderOrder(data []byte) ([]string, error) {
+	var order []string
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeField(data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		if num == worldShaderField && typ == protowire.BytesType {
+			_, _, t := protowire.ConsumeTag(data)
+			entry, _ := protowire.ConsumeBytes(data[t:n])
+			name := ""
+			for len(entry) > 0 {
+				enum, etyp, en := protowire.ConsumeField(entry)
+				if en < 0 {
+					return nil, protowire.ParseError(en)
+				}
+				if enum == 1 && etyp == protowire.BytesType {
+					_, _, et := protowire.ConsumeTag(entry)
+					name, _ = protowire.ConsumeString(entry[et:en])
+				}
+				entry = entry[en:]
+			}
+			order = append(order, name)
+		}
+		data = data[n:]
+	}
+	return order, nil
+}
+
+// MarshalWorld encodes the world with its shaders in the given order, so the encoding is reproducible.
+// Shaders missing from the order are appended sorted by name.
+func MarshalWorld(world *perspectivego.World, order []string) ([]byte, error) {
+	order = append([]string{}, order...)
+	seen := make(map[string]bool, len(order))
+	for _, n := range order {
+		if _, ok := world.Shader[n]; !ok {
+			return nil, errors.New("Missing shader: " + n)
+		}
+		seen[n] = true
+	}
+	for _, n := range SortedShaderNames(world) {
+		if !seen[n] {
+			order = append(order, n)
+		}
+	}
+	var shaders []byte
+	for _, n := range order {
+		value, err := proto.Marshal(world.Shader[n])
+		if err != nil {
+			return nil, err
+		}
+		var entry []byte
+		entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+		entry = protowire.AppendString(entry, n)
+		entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+		entry = protowire.AppendBytes(entry, value)
+		shaders = protowire.AppendTag(shaders, worldShaderField, protowire.BytesType)
+		shaders = protowire.AppendBytes(shaders, entry)
+	}
+	w := proto.Clone(world).(*perspectivego.World)
+	w.Shader = nil
+	rest, err := proto.Marshal(w)
+	if err != nil {
+		return nil, err
+	}
+	// Insert the shaders before the first field that follows them
+	var data []byte
+	for len(rest) > 0 {
+		num, _, n := protowire.ConsumeField(rest)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		if num > worldShaderField && shaders != nil {
+			data = append(data, shaders...)
+			shaders = nil
+		}
+		data = append(data, rest[:n]...)
+		rest = rest[n:]
+	}
+	return append(data, shaders...), nil
+}
+
+func SortedShaderNames(world *perspectivego.World) []string {
+	names := make([]string, 0, len(world.Shader))
+	for n := range world.Shader {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// UnpackWorld writes the given world data into the directory, and checks that packing the directory reproduces the data.
+// The world is unpacked into a staging directory beside it first, so the directory is only changed once the check passes.
+func UnpackWorld(data []byte, directory string) error {
+	world := &perspectivego.World{}
+	if err := proto.Unmarshal(data, world); err != nil {
+		return err
+	}
+	order, err := ShaderOrder(data)
+	if err != nil {
+		return err
+	}
+	directory = path.Clean(directory)
+	if err := os.MkdirAll(directory, os.ModePerm); err != nil {
+		return err
+	}
+	staging, err := ioutil.TempDir(path.Dir(directory), "."+path.Base(directory)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+	if err := writeUnpackedWorld(world, order, staging); err != nil {
+		return err
+	}
+	packed, err := PackWorld(staging)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(packed, data) {
+		return errors.New("Unpacked world does not reproduce the original, it may contain fields the unpacked layout cannot represent")
+	}
+	return moveUnpackedWorld(staging, directory)
+}
+
+func writeUnpackedWorld(world *perspectivego.World, order []string, directory string) error {
+	puzzles := path.Join(directory, PUZZLES_DIRECTORY)
+	shaders := path.Join(directory, SHADERS_DIRECTORY)
+	for _, d := range []string{puzzles, shaders} {
+		if err := os.MkdirAll(d, os.ModePerm); err != nil {
+			return err
+		}
+	}
+
+	manifest := &bytes.Buffer{}
+	fmt.Fprintln(manifest, "name:"+world.Name)
+	if world.Title != "" {
+		fmt.Fprintln(manifest, "title:"+world.Title)
+	}
+	fmt.Fprintln(manifest, "size:"+strconv.Itoa(int(world.Size)))
+	fmt.Fprintln(manifest, "foreground:"+world.ForegroundColour)
+	fmt.Fprintln(manifest, "background:"+world.BackgroundColour)
+	for _, n := range order {
+		s := world.Shader[n]
+		if n == "" || strings.ContainsAny(n, "/\n") {
+			return errors.New("Cannot unpack shader name: " + n)
+		}
+		fmt.Fprintln(manifest, "shader:"+n)
+		for _, a := range s.Attributes {
+			fmt.Fprintln(manifest, "attribute:"+a)
+		}
+		for _, u := range s.Uniforms {
+			fmt.Fprintln(manifest, "uniform:"+u)
+		}
+		if err := ioutil.WriteFile(path.Join(shaders, n+".vert"), []byte(s.VertexSource), os.ModePerm); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path.Join(shaders, n+".frag"), []byte(s.FragmentSource), os.ModePerm); err != nil {
+			return err
+		}
+	}
+	width := len(strconv.Itoa(len(world.Puzzle)))
+	if width < 3 {
+		width = 3
+	}
+	for i, p := range world.Puzzle {
+		name := fmt.Sprintf("puzzle%0*d", width, i+1)
+		// Use the text format where it is lossless as it produces the most readable diffs
+		filename := name + ".txt"
+		content, ok := puzzleText(p)
+		if !ok {
+			j := &bytes.Buffer{}
+			if err := WritePuzzleJSON(j, p); err != nil {
+				return err
+			}
+			filename = name + ".json"
+			content = j.Bytes()
+		}
+		if err := ioutil.WriteFile(path.Join(puzzles, filename), content, os.ModePerm); err != nil {
+			return err
+		}
+		fmt.Fprintln(manifest, "puzzle:"+path.Join(PUZZLES_DIRECTORY, filename))
+	}
+	return ioutil.WriteFile(path.Join(directory, MANIFEST_FILE), manifest.Bytes(), os.ModePerm)
+}
+
+// moveUnpackedWorld replaces the unpacked world in the directory with the one in staging, leaving any other files in place.
+func moveUnpackedWorld(staging, directory string) error {
+	for _, d := range []struct {
+		name     string
+		suffixes []string
+	}{
+		{PUZZLES_DIRECTORY, []string{".txt", ".json"}},
+		{SHADERS_DIRECTORY, []string{".vert", ".frag"}},
+	} {
+		to := path.Join(directory, d.name)
+		if err := os.MkdirAll(to, os.ModePerm); err != nil {
+			return err
+		}
+		// Remove files left over from a previous unpack so they don't linger in version control
+		if err := removeFiles(to, d.suffixes...); err != nil {
+			return err
+		}
+		files, err := ioutil.ReadDir(path.Join(staging, d.name))
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			if err := os.Rename(path.Join(staging, d.name, f.Name()), path.Join(to, f.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return os.Rename(path.Join(staging, MANIFEST_FILE), path.Join(directory, MANIFEST_FILE))
+}
+
+// puzzleText returns the puzzle in the text format, and whether reading it back gives the same puzzle.
+// Fields the format cannot hold are checked before reading it back, as ReadPuzzle exits or panics on them.
+func puzzleText(puzzle *perspectivego.Puzzle) ([]byte, bool) {
+	fields := []string{puzzle.Description}
+	if o := puzzle.Outline; o != nil {
+		fields = append(fields, o.Mesh, o.Colour, o.Texture, o.Material, o.Shader)
+	}
+	var locations []*perspectivego.Location
+	for _, e := range puzzle.Goal {
+		fields = append(fields, e.Name, e.Mesh, e.Colour, e.Texture, e.Material, e.Shader)
+		locations = append(locations, e.Location)
+	}
+	for _, e := range puzzle.Block {
+		fields = append(fields, e.Name, e.Mesh, e.Colour, e.Texture, e.Material, e.Shader)
+		locations = append(locations, e.Location)
+	}
+	for _, e := range puzzle.Sphere {
+		fields = append(fields, e.Name, e.Mesh, e.Colour, e.Texture, e.Material, e.Shader)
+		locations = append(locations, e.Location)
+	}
+	for _, e := range puzzle.Portal {
+		fields = append(fields, e.Name, e.Mesh, e.Colour, e.Texture, e.Material, e.Shader)
+		locations = append(locations, e.Location, e.Link)
+	}
+	for _, f := range fields {
+		if strings.ContainsAny(f, ":\r\n") {
+			return nil, false
+		}
+	}
+	for _, l := range locations {
+		if l == nil {
+			return nil, false
+		}
+	}
+	text := &bytes.Buffer{}
+	if err := perspectivego.WritePuzzle(text, puzzle); err != nil {
+		return nil, false
+	}
+	parsed, err := perspectivego.ReadPuzzle(bytes.NewReader(text.Bytes()))
+	if err != nil || !proto.Equal(parsed, puzzle) {
+		return nil, false
+	}
+	return text.Bytes(), true
+}
+
+// PackWorld reads an unpacked world from the directory and returns its encoding.
+func PackWorld(directory string) ([]byte, error) {
+	world, order, err := ReadUnpackedWorld(directory)
+	if err != nil {
+		return nil, err
+	}
+	return MarshalWorld(world, order)
+}
+
+// ReadUnpackedWorld reads an unpacked world from the directory, and returns it along with the order of its shaders.
+func ReadUnpackedWorld(directory string) (*perspectivego.World, []string, error) {
+	file, err := os.Open(path.Join(directory, MANIFEST_FILE))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Split(bufio.ScanLines)
+
+	world := &perspectivego.World{}
+	var order []string
+	var shader *joygo.Shader
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			return nil, nil, errors.New("Malformed line: " + line)
+		}
+		value := parts[1]
+		switch parts[0] {
+		case "name":
+			world.Name = value
+		case "title":
+			world.Title = value
+		case "size":
+			size, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return nil, nil, err
+			}
+			world.Size = uint32(size)
+		case "foreground":
+			world.ForegroundColour = value
+		case "background":
+			world.BackgroundColour = value
+		case "shader":
+			name := value
+			vertex, err := ioutil.ReadFile(path.Join(directory, SHADERS_DIRECTORY, name+".vert"))
+			if err != nil {
+				return nil, nil, err
+			}
+			fragment, err := ioutil.ReadFile(path.Join(directory, SHADERS_DIRECTORY, name+".frag"))
+			if err != nil {
+				return nil, nil, err
+			}
+			if world.Shader == nil {
+				world.Shader = make(map[string]*joygo.Shader)
+			}
+			shader = &joygo.Shader{
+				Name:           name,
+				VertexSource:   string(vertex),
+				FragmentSource: string(fragment),
+			}
+			world.Shader[name] = shader
+			order = append(order, name)
+		case "attribute":
+			if shader == nil {
+				return nil, nil, errors.New("Attribute without shader: " + line)
+			}
+			shader.Attributes = append(shader.Attributes, value)
+		case "uniform":
+			if shader == nil {
+				return nil, nil, errors.New("Uniform without shader: " + line)
+			}
+			shader.Uniforms = append(shader.Uniforms, value)
+		case "puzzle":
+			puzzle, err := ReadPuzzleFile(path.Join(directory, value))
+			if err != nil {
+				return nil, nil, err
+			}
+			world.Puzzle = append(world.Puzzle, puzzle)
+		default:
+			return nil, nil, errors.New("Unrecognized line: " + line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return world, order, nil
+}
+
+// ReadPuzzleFile reads a puzzle in JSON if the file name ends in .json, otherwise in the text format.
+func ReadPuzzleFile(filename string) (*perspectivego.Puzzle, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if strings.HasSuffix(filename, ".json") {
+		return ReadPuzzleJSON(file)
+	}
+	return perspectivego.ReadPuzzle(file)
+}
+
+func removeFiles(directory string, suffixes ...string) error {
+	files, err := ioutil.ReadDir(directory)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		for _, s := range suffixes {
+			if !f.IsDir() && strings.HasSuffix(f.Name(), s) {
+				if err := os.Remove(path.Join(directory, f.Name())); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
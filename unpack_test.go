@@ -0,0 +1,104 @@
+/*
+ * Copyright 2019 Aletheia Ware LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package perspectiveeditorgo
+
+import (
+	"bytes"
+	"github.com/AletheiaWareLLC/perspectivego"
+	"google.golang.org/protobuf/encoding/protowire"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func testWorld() *perspectivego.World {
+	plain := generateTestPuzzle(1, CubeVolume(5), DefaultPortalTopology(), 4, 2)
+	colons := generateTestPuzzle(2, CubeVolume(5), DefaultPortalTopology(), 4, 2)
+	colons.Block[0].Name = "b:0"
+	colons.Description = "a: b"
+	return &perspectivego.World{
+		Name:   "test",
+		Size:   5,
+		Puzzle: []*perspectivego.Puzzle{plain, colons},
+	}
+}
+
+func TestUnpackWorldFallsBackToJSON(t *testing.T) {
+	data, err := MarshalWorld(testWorld(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	directory, err := ioutil.TempDir("", "unpack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	if err := UnpackWorld(data, directory); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"puzzle001.txt", "puzzle002.json"} {
+		if _, err := os.Stat(path.Join(directory, PUZZLES_DIRECTORY, f)); err != nil {
+			t.Error(err)
+		}
+	}
+	packed, err := PackWorld(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(packed, data) {
+		t.Error("Packed world does not match")
+	}
+}
+
+func TestUnpackWorldLeavesDirectoryOnFailure(t *testing.T) {
+	data, err := MarshalWorld(testWorld(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	directory, err := ioutil.TempDir("", "unpack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	if err := UnpackWorld(data, directory); err != nil {
+		t.Fatal(err)
+	}
+	// An unknown field cannot be represented, so unpacking fails the comparison
+	unknown := protowire.AppendTag(append([]byte{}, data...), 99, protowire.VarintType)
+	unknown = protowire.AppendVarint(unknown, 1)
+	if err := UnpackWorld(unknown, directory); err == nil {
+		t.Fatal("Expected an error")
+	}
+	packed, err := PackWorld(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(packed, data) {
+		t.Error("Failed unpack changed the directory")
+	}
+	files, err := ioutil.ReadDir(path.Dir(directory))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if strings.HasPrefix(f.Name(), "."+path.Base(directory)+"-") {
+			t.Error("Staging directory left behind:", f.Name())
+		}
+	}
+}
@@ -0,0 +1,414 @@
+/*
+ * Copyright 2019 Aletheia Ware LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package perspectiveeditorgo
+
+import (
+	"errors"
+	"fmt"
+	"github.com/AletheiaWareLLC/perspectivego"
+	"strings"
+)
+
+var directionNames = map[string]*perspectivego.Location{
+	"left":     left,
+	"right":    right,
+	"down":     down,
+	"up":       up,
+	"backward": backward,
+	"forward":  foreward,
+}
+
+// Verification is the result of simulating a sequence of gravity directions.
+type Verification struct {
+	Solved    bool
+	Rotations int
+	// Portals holds the names of the portals traversed, in order
+	Portals []string
+	// Location is where the sphere came to rest, left the world, or reached the goal
+	Location *perspectivego.Location
+	// Failure explains why an unsolved sequence failed, and FailedMove is the index of the move which failed, or -1 if the moves ran out
+	Failure    string
+	FailedMove int
+}
+
+// ParseDirection parses a gravity direction name: left, right, down, up, backward or forward.
+func ParseDirection(s string) (*perspectivego.Location, error) {
+	if d, ok := directionNames[strings.ToLower(strings.TrimSpace(s))]; ok {
+		return d, nil
+	}
+	return nil, errors.New("Unrecognized direction: " + s)
+}
+
+// ParseDirections parses a list of direction names separated by commas or whitespace.
+func ParseDirections(s string) ([]*perspectivego.Location, error) {
+	var moves []*perspectivego.Location
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	}) {
+		d, err := ParseDirection(f)
+		if err != nil {
+			return nil, err
+		}
+		moves = append(moves, d)
+	}
+	return moves, nil
+}
+
+// DirectionName returns the name of a gravity direction, or its location if it is not one of the six directions.
+func DirectionName(direction *perspectivego.Location) string {
+	for n, d := range directionNames {
+		if d.X == direction.X && d.Y == direction.Y && d.Z == direction.Z {
+			return n
+		}
+	}
+	return perspectivego.LocationToString(direction)
+}
+
+// SolutionRotations returns the rotations made by a sequence of gravity directions, where the first costs a rotation unless it is down.
+func SolutionRotations(moves []*perspectivego.Location) int {
+	if len(moves) == 0 {
+		return 0
+	}
+	rotations := len(moves) - 1
+	if moves[0] != down {
+		rotations++
+	}
+	return rotations
+}
+
+// SolutionDirections returns the gravity direction held in the value of each move of the solution.
+func SolutionDirections(solution *perspectivego.Solution) ([]*perspectivego.Location, error) {
+	var moves []*perspectivego.Location
+	for i, m := range solution.Move {
+		if m.Value == nil {
+			return nil, fmt.Errorf("Move %d has no direction", i)
+		}
+		d, err := ParseDirection(DirectionName(m.Value))
+		if err != nil {
+			return nil, fmt.Errorf("Move %d: %s", i, err)
+		}
+		moves = append(moves, d)
+	}
+	return moves, nil
+}
+
+// VerifySolution simulates the sphere under each gravity direction in turn, using the same rules as ScoreDirection.
+// The first direction is the gravity at the start, which costs a rotation unless it is down, and each later direction
+// is a rotation made once the sphere has come to rest against a block. A sequence is solved when the last move reaches a goal.
+func VerifySolution(puzzle *perspectivego.Puzzle, size uint32, moves []*perspectivego.Location) *Verification {
+	return VerifySolutionBounds(puzzle, LegacyBounds(size), moves)
+}
+
+// VerifySolutionBounds is like VerifySolution but applies the given bounds model at the edge of the world.
+func VerifySolutionBounds(puzzle *perspectivego.Puzzle, bounds *Bounds, moves []*perspectivego.Location) *Verification {
+	v := &Verification{
+		FailedMove: -1,
+	}
+	if len(puzzle.Sphere) == 0 {
+		v.Failure = "Puzzle has no sphere"
+		return v
+	}
+	if len(moves) == 0 {
+		v.Failure = "No moves"
+		return v
+	}
+	simulation := NewBoundedSimulation(puzzle, bounds)
+	sphere := puzzle.Sphere[0].Location
+	v.Location = sphere
+	var direction *perspectivego.Location
+	portaled := false
+	for i, m := range moves {
+		if i == 0 {
+			if m != down {
+				v.Rotations++
+			}
+		} else {
+			if m == direction {
+				v.Failure = "Gravity is already " + DirectionName(m)
+				v.FailedMove = i
+				return v
+			}
+			v.Rotations++
+		}
+		var portals []string
+		var outcome int
+		sphere, direction, portaled, portals, outcome = simulation.Walk(sphere, m, portaled)
+		v.Location = sphere
+		v.Portals = append(v.Portals, portals...)
+		switch outcome {
+		case WALK_GOAL:
+			if i < len(moves)-1 {
+				v.Failure = "Goal reached before the last move"
+				v.FailedMove = i + 1
+				return v
+			}
+			v.Solved = true
+			return v
+		case WALK_OUT:
+			v.Failure = "Sphere fell out of the world"
+			v.FailedMove = i
+			return v
+		case WALK_LOOP:
+			v.Failure = "Infinite portal loop"
+			v.FailedMove = i
+			return v
+		}
+	}
+	v.Failure = "Moves ended before reaching a goal"
+	return v
+}
+
+// Outcomes of a walk
+const (
+	WALK_REST = iota
+	WALK_GOAL
+	WALK_OUT
+	WALK_LOOP
+)
+
+// Simulation moves a sphere through a puzzle using the same rules as ScoreDirection.
+type Simulation struct {
+	Bounds  *Bounds
+	Blocks  map[string]bool
+	Goals   map[string]bool
+	Portals map[string]*perspectivego.Portal
+}
+
+func NewSimulation(puzzle *perspectivego.Puzzle, size uint32) *Simulation {
+	return NewBoundedSimulation(puzzle, LegacyBounds(size))
+}
+
+func NewBoundedSimulation(puzzle *perspectivego.Puzzle, bounds *Bounds) *Simulation {
+	s := &Simulation{
+		Bounds:  bounds,
+		Blocks:  make(map[string]bool, len(puzzle.Block)),
+		Goals:   make(map[string]bool, len(puzzle.Goal)),
+		Portals: make(map[string]*perspectivego.Portal, len(puzzle.Portal)),
+	}
+	for _, b := range puzzle.Block {
+		s.Blocks[b.Location.String()] = true
+	}
+	for _, g := range puzzle.Goal {
+		s.Goals[g.Location.String()] = true
+	}
+	for _, p := range puzzle.Portal {
+		if !IsExit(p) {
+			s.Portals[p.Location.String()] = p
+		}
+	}
+	return s
+}
+
+// Walk moves the sphere from the given location under the given gravity until it rests against a block or wall, reaches a goal, leaves the world or loops through portals or around the world.
+// Portaled is true if the sphere has just arrived through a portal, so it is not sent back through a portal at the given location, as in ScoreDirection.
+// It returns where the sphere stopped, the gravity at that point, whether it just arrived through a portal, the names of the portals traversed and the outcome.
+func (s *Simulation) Walk(location, direction *perspectivego.Location, portaled bool) (*perspectivego.Location, *perspectivego.Location, bool, []string, int) {
+	sphere := &perspectivego.Location{
+		X: location.X,
+		Y: location.Y,
+		Z: location.Z,
+	}
+	var traversed []string
+	usage := make(map[string]int)
+	wraps := make(map[string]bool)
+	for {
+		if !s.Bounds.Contains(sphere) {
+			return sphere, direction, portaled, traversed, WALK_OUT
+		}
+		key := sphere.String()
+		if s.Goals[key] {
+			return sphere, direction, portaled, traversed, WALK_GOAL
+		}
+		if p, ok := s.Portals[key]; ok && !portaled {
+			if usage[key] >= MAX_PORTAL_USES {
+				return sphere, direction, portaled, traversed, WALK_LOOP
+			}
+			usage[key]++
+			traversed = append(traversed, p.Name)
+			sphere.X = p.Link.X
+			sphere.Y = p.Link.Y
+			sphere.Z = p.Link.Z
+			if gravity := PortalGravity(p); gravity != nil {
+				direction = gravity
+			}
+			portaled = true
+			continue
+		}
+		next, ok, wrapped := s.Bounds.Next(sphere, direction)
+		if !ok || s.Blocks[next.String()] {
+			return sphere, direction, portaled, traversed, WALK_REST
+		}
+		if wrapped {
+			key := next.String() + direction.String()
+			if wraps[key] {
+				return sphere, direction, portaled, traversed, WALK_LOOP
+			}
+			wraps[key] = true
+		}
+		sphere.X = next.X
+		sphere.Y = next.Y
+		sphere.Z = next.Z
+		portaled = false
+	}
+}
+
+// restKey identifies a resting state by the sphere's location and gravity, and whether it has just arrived through a portal.
+func restKey(location, direction *perspectivego.Location, portaled bool) string {
+	key := location.String() + direction.String()
+	if portaled {
+		key += "portaled"
+	}
+	return key
+}
+
+// Solve returns a sequence of gravity directions which reaches a goal with the fewest rotations, in the form accepted by VerifySolution, or nil if the puzzle cannot be solved.
+func Solve(puzzle *perspectivego.Puzzle, size uint32) []*perspectivego.Location {
+	return SolveBounds(puzzle, LegacyBounds(size))
+}
+
+// SolveBounds is like Solve but applies the given bounds model at the edge of the world.
+func SolveBounds(puzzle *perspectivego.Puzzle, bounds *Bounds) []*perspectivego.Location {
+	if len(puzzle.Sphere) == 0 {
+		return nil
+	}
+	simulation := NewBoundedSimulation(puzzle, bounds)
+	type state struct {
+		location  *perspectivego.Location
+		direction *perspectivego.Location
+		portaled  bool
+		moves     []*perspectivego.Location
+	}
+	var queue []*state
+	seen := make(map[string]bool)
+	// Starting with gravity down costs no rotation so it is searched first, and every later move costs one, so the queue stays ordered by rotations
+	start := puzzle.Sphere[0].Location
+	queue = append(queue, &state{start, nil, false, nil})
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		options := directions
+		if current.direction == nil {
+			options = append([]*perspectivego.Location{down}, left, right, up, backward, foreward)
+		}
+		for _, d := range options {
+			if d == current.direction {
+				continue
+			}
+			location, direction, portaled, _, outcome := simulation.Walk(current.location, d, current.portaled)
+			moves := append(append([]*perspectivego.Location{}, current.moves...), d)
+			switch outcome {
+			case WALK_GOAL:
+				return moves
+			case WALK_REST:
+				key := restKey(location, direction, portaled)
+				if !seen[key] {
+					seen[key] = true
+					queue = append(queue, &state{location, direction, portaled, moves})
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// OptimalSolutions returns up to limit distinct sequences of gravity directions which reach a goal with the fewest rotations, or nil if the puzzle cannot be solved.
+// A puzzle has a unique optimal solution when exactly one sequence is returned with a limit of two or more.
+func OptimalSolutions(puzzle *perspectivego.Puzzle, bounds *Bounds, limit int) [][]*perspectivego.Location {
+	if len(puzzle.Sphere) == 0 || limit <= 0 {
+		return nil
+	}
+	simulation := NewBoundedSimulation(puzzle, bounds)
+	type state struct {
+		location  *perspectivego.Location
+		direction *perspectivego.Location
+		portaled  bool
+		rotations int
+		// parents holds each state from which this one is reached with the fewest rotations, or nil for the start, and moves the direction taken from each
+		parents []*state
+		moves   []*perspectivego.Location
+	}
+	states := make(map[string]*state)
+	// levels holds the states reached with each number of rotations
+	var levels [][]*state
+	// goal collects the ways of reaching a goal with the fewest rotations found so far
+	goal := &state{rotations: -1}
+	reach := func(rotations int, parent *state, location, d *perspectivego.Location, portaled bool) {
+		location, direction, portaled, _, outcome := simulation.Walk(location, d, portaled)
+		var s *state
+		switch outcome {
+		case WALK_GOAL:
+			if goal.rotations >= 0 && goal.rotations < rotations {
+				return
+			}
+			goal.rotations = rotations
+			s = goal
+		case WALK_REST:
+			key := restKey(location, direction, portaled)
+			var ok bool
+			s, ok = states[key]
+			if !ok {
+				s = &state{location: location, direction: direction, portaled: portaled, rotations: rotations}
+				states[key] = s
+				for len(levels) <= rotations {
+					levels = append(levels, nil)
+				}
+				levels[rotations] = append(levels[rotations], s)
+			} else if s.rotations < rotations {
+				return
+			}
+		default:
+			return
+		}
+		s.parents = append(s.parents, parent)
+		s.moves = append(s.moves, d)
+	}
+	// Starting with gravity down costs no rotation so it is reached first, and any other direction costs one
+	start := puzzle.Sphere[0].Location
+	reach(0, nil, start, down, false)
+	for _, d := range directions {
+		if d != down {
+			reach(1, nil, start, d, false)
+		}
+	}
+	for rotations := 0; rotations < len(levels) && (goal.rotations < 0 || rotations < goal.rotations); rotations++ {
+		for _, s := range levels[rotations] {
+			for _, d := range directions {
+				if d != s.direction {
+					reach(rotations+1, s, s.location, d, s.portaled)
+				}
+			}
+		}
+	}
+	// Enumerate the sequences backwards from the goal
+	var solutions [][]*perspectivego.Location
+	var expand func(s *state, suffix []*perspectivego.Location)
+	expand = func(s *state, suffix []*perspectivego.Location) {
+		for i, p := range s.parents {
+			if len(solutions) >= limit {
+				return
+			}
+			moves := append([]*perspectivego.Location{s.moves[i]}, suffix...)
+			if p == nil {
+				solutions = append(solutions, moves)
+			} else {
+				expand(p, moves)
+			}
+		}
+	}
+	expand(goal, nil)
+	return solutions
+}
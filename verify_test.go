@@ -0,0 +1,43 @@
+/*
+ * Copyright 2019 Aletheia Ware LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package perspectiveeditorgo
+
+import (
+	"testing"
+)
+
+func TestSolveMatchesScore(t *testing.T) {
+	volume := CubeVolume(5)
+	solved := 0
+	for seed := int64(0); seed < 2000; seed++ {
+		puzzle := generateTestPuzzle(seed, volume, DefaultPortalTopology(), 10, 4)
+		score, _ := Score(puzzle, 5)
+		solution := BAD
+		if moves := Solve(puzzle, 5); moves != nil {
+			solution = SolutionRotations(moves)
+		}
+		if score != solution {
+			t.Fatalf("seed %d: Score %d, Solve %d", seed, score, solution)
+		}
+		if score != BAD {
+			solved++
+		}
+	}
+	if solved == 0 {
+		t.Fatal("No generated puzzle could be solved")
+	}
+}
@@ -0,0 +1,141 @@
+/*
+ * Copyright 2019 Aletheia Ware LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package perspectiveeditorgo
+
+import (
+	"errors"
+	"github.com/AletheiaWareLLC/perspectivego"
+	"strconv"
+	"strings"
+)
+
+// Volume is the extent of a puzzle along the X, Y and Z axes, each odd so the puzzle is centred on the origin.
+type Volume struct {
+	Width  uint32
+	Height uint32
+	Depth  uint32
+}
+
+// CubeVolume returns a volume with the given size along every axis.
+func CubeVolume(size uint32) *Volume {
+	return &Volume{
+		Width:  size,
+		Height: size,
+		Depth:  size,
+	}
+}
+
+// ParseVolume parses either a single size for a cube, or <width>x<height>x<depth>.
+func ParseVolume(s string) (*Volume, error) {
+	parts := strings.Split(s, "x")
+	if len(parts) != 1 && len(parts) != 3 {
+		return nil, errors.New("Malformed volume: " + s)
+	}
+	var extents []uint32
+	for _, p := range parts {
+		e, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, err
+		}
+		if e <= 0 {
+			return nil, errors.New("World size must be postive")
+		}
+		if e%2 == 0 {
+			return nil, errors.New("World size must be odd")
+		}
+		extents = append(extents, uint32(e))
+	}
+	if len(extents) == 1 {
+		return CubeVolume(extents[0]), nil
+	}
+	return &Volume{
+		Width:  extents[0],
+		Height: extents[1],
+		Depth:  extents[2],
+	}, nil
+}
+
+func (v *Volume) String() string {
+	if v.IsCube() {
+		return strconv.FormatUint(uint64(v.Width), 10)
+	}
+	return strconv.FormatUint(uint64(v.Width), 10) + "x" + strconv.FormatUint(uint64(v.Height), 10) + "x" + strconv.FormatUint(uint64(v.Depth), 10)
+}
+
+func (v *Volume) IsCube() bool {
+	return v.Width == v.Height && v.Height == v.Depth
+}
+
+// Extents returns the width, height and depth.
+func (v *Volume) Extents() [3]uint32 {
+	return [3]uint32{v.Width, v.Height, v.Depth}
+}
+
+// Size returns the largest extent, which is the size of the smallest world cube containing the volume.
+func (v *Volume) Size() uint32 {
+	size := v.Width
+	if v.Height > size {
+		size = v.Height
+	}
+	if v.Depth > size {
+		size = v.Depth
+	}
+	return size
+}
+
+// Cells returns the number of locations in the volume.
+func (v *Volume) Cells() int {
+	return int(v.Width) * int(v.Height) * int(v.Depth)
+}
+
+// Bounds returns bounds of the given model for the volume, where each coordinate runs from -extent/2 to extent-extent/2-1, the range of RandomLocation.
+// Legacy bounds instead let the sphere fall off once a coordinate exceeds the extent along its axis.
+func (v *Volume) Bounds(model string) (*Bounds, error) {
+	bounds := &Bounds{
+		Model: model,
+	}
+	for i, e := range v.Extents() {
+		switch model {
+		case "", BOUNDS_LEGACY:
+			bounds.Model = BOUNDS_LEGACY
+			bounds.Min[i] = -int32(e)
+			bounds.Max[i] = int32(e)
+		case BOUNDS_FALL, BOUNDS_WALL, BOUNDS_WRAP:
+			bounds.Min[i] = -int32(e / 2)
+			bounds.Max[i] = int32(e) + bounds.Min[i] - 1
+		default:
+			return nil, errors.New("Unrecognized bounds: " + model)
+		}
+	}
+	return bounds, nil
+}
+
+// GenerateVolumeLocation returns a random unoccupied location within the volume, and marks it occupied.
+func GenerateVolumeLocation(occupied map[string]bool, volume *Volume) *perspectivego.Location {
+	location := &perspectivego.Location{}
+	var key string
+	for {
+		location.X = int32(RandomLocation(volume.Width))
+		location.Y = int32(RandomLocation(volume.Height))
+		location.Z = int32(RandomLocation(volume.Depth))
+		key = location.String()
+		if !occupied[key] {
+			occupied[key] = true
+			return location
+		}
+	}
+}
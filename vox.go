@@ -0,0 +1,281 @@
+/*
+ * Copyright 2019 Aletheia Ware LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package perspectiveeditorgo
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/AletheiaWareLLC/perspectivego"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+)
+
+// VOX_PALETTE_COLOUR as an element colour uses the colour of the voxel from the model's palette.
+const VOX_PALETTE_COLOUR = "palette"
+
+type Voxel struct {
+	X, Y, Z uint8
+	// Index is the palette index of the voxel, from 1 to 255
+	Index uint8
+}
+
+// VoxModel is the first model in a MagicaVoxel .vox file.
+type VoxModel struct {
+	SizeX, SizeY, SizeZ int
+	Voxels              []*Voxel
+	// Palette holds the colour of each palette index, or nil if the file has no palette
+	Palette []color.NRGBA
+}
+
+// VoxRole describes the element created for each voxel whose palette index is in Indices.
+// Attribute lists are cycled through like Generate, and portal attributes advance once per pair.
+type VoxRole struct {
+	ElementStyle
+	Indices []uint8
+}
+
+func ReadVox(reader io.Reader) (*VoxModel, error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 8 || string(data[:4]) != "VOX " {
+		return nil, errors.New("Not a vox file")
+	}
+	data = data[8:]
+	model := &VoxModel{}
+	sized := false
+	filled := false
+	for len(data) >= 12 {
+		id := string(data[:4])
+		content := int(binary.LittleEndian.Uint32(data[4:8]))
+		if 12+content > len(data) {
+			return nil, errors.New("Truncated chunk: " + id)
+		}
+		body := data[12 : 12+content]
+		switch id {
+		case "MAIN":
+			// Children follow directly, so continue with the next chunk
+		case "SIZE":
+			if !sized {
+				if len(body) < 12 {
+					return nil, errors.New("Malformed SIZE chunk")
+				}
+				model.SizeX = int(binary.LittleEndian.Uint32(body[0:4]))
+				model.SizeY = int(binary.LittleEndian.Uint32(body[4:8]))
+				model.SizeZ = int(binary.LittleEndian.Uint32(body[8:12]))
+				sized = true
+			}
+		case "XYZI":
+			if !filled {
+				if len(body) < 4 {
+					return nil, errors.New("Malformed XYZI chunk")
+				}
+				count := int(binary.LittleEndian.Uint32(body[0:4]))
+				if 4+4*count > len(body) {
+					return nil, errors.New("Truncated XYZI chunk")
+				}
+				for i := 0; i < count; i++ {
+					v := body[4+4*i : 8+4*i]
+					model.Voxels = append(model.Voxels, &Voxel{
+						X:     v[0],
+						Y:     v[1],
+						Z:     v[2],
+						Index: v[3],
+					})
+				}
+				filled = true
+			}
+		case "RGBA":
+			if len(body) < 1024 {
+				return nil, errors.New("Malformed RGBA chunk")
+			}
+			// Palette entry i holds the colour of index i + 1
+			model.Palette = make([]color.NRGBA, 256)
+			for i := 0; i < 255; i++ {
+				model.Palette[i+1] = color.NRGBA{
+					R: body[4*i],
+					G: body[4*i+1],
+					B: body[4*i+2],
+					A: body[4*i+3],
+				}
+			}
+		}
+		if id == "MAIN" {
+			data = data[12+content:]
+		} else {
+			children := int(binary.LittleEndian.Uint32(data[8:12]))
+			if 12+content+children > len(data) {
+				return nil, errors.New("Truncated chunk: " + id)
+			}
+			data = data[12+content+children:]
+		}
+	}
+	if !sized || !filled {
+		return nil, errors.New("Missing model")
+	}
+	return model, nil
+}
+
+// ImportVox creates a puzzle from the model, centred in a world of the given size.
+// MagicaVoxel is Z-up, so the model's X, Y and Z become the puzzle's X, Z and Y.
+// Portals are paired in order of location within each palette index, so each pair should be drawn with its own index.
+func ImportVox(model *VoxModel, size uint32, goal, sphere, block, portal *VoxRole) (*perspectivego.Puzzle, error) {
+	if model.SizeX > int(size) || model.SizeY > int(size) || model.SizeZ > int(size) {
+		return nil, fmt.Errorf("Model %dx%dx%d does not fit in world of size %d", model.SizeX, model.SizeY, model.SizeZ, size)
+	}
+	roles := make(map[uint8]*VoxRole)
+	for _, r := range []*VoxRole{goal, sphere, block, portal} {
+		if r == nil {
+			continue
+		}
+		if len(r.Indices) > 0 && !r.Valid() {
+			return nil, errors.New("Missing role attributes")
+		}
+		for _, i := range r.Indices {
+			if _, ok := roles[i]; ok {
+				return nil, fmt.Errorf("Palette index %d has multiple roles", i)
+			}
+			roles[i] = r
+		}
+	}
+	// Sort voxels so the element names and portal pairs are stable
+	voxels := append([]*Voxel{}, model.Voxels...)
+	sort.Slice(voxels, func(i, j int) bool {
+		a, b := voxels[i], voxels[j]
+		if a.Index != b.Index {
+			return a.Index < b.Index
+		}
+		if a.Z != b.Z {
+			return a.Z < b.Z
+		}
+		if a.Y != b.Y {
+			return a.Y < b.Y
+		}
+		return a.X < b.X
+	})
+	location := func(v *Voxel) *perspectivego.Location {
+		return &perspectivego.Location{
+			X: int32(v.X) - int32(model.SizeX/2),
+			Y: int32(v.Z) - int32(model.SizeZ/2),
+			Z: int32(v.Y) - int32(model.SizeY/2),
+		}
+	}
+	colour := func(r *VoxRole, i int, v *Voxel) (string, error) {
+		c := r.Colour[i%len(r.Colour)]
+		if c != VOX_PALETTE_COLOUR {
+			return c, nil
+		}
+		if model.Palette == nil {
+			return "", errors.New("Model has no palette")
+		}
+		p := model.Palette[v.Index]
+		return fmt.Sprintf("#%02x%02x%02x%02x", p.R, p.G, p.B, p.A), nil
+	}
+
+	puzzle := &perspectivego.Puzzle{}
+	var pending *perspectivego.Portal
+	var pendingIndex uint8
+	for _, v := range voxels {
+		r, ok := roles[v.Index]
+		if !ok {
+			continue
+		}
+		switch r {
+		case goal:
+			i := len(puzzle.Goal)
+			c, err := colour(r, i, v)
+			if err != nil {
+				return nil, err
+			}
+			puzzle.Goal = append(puzzle.Goal, &perspectivego.Goal{
+				Name:     "g" + strconv.Itoa(i),
+				Mesh:     r.Mesh[i%len(r.Mesh)],
+				Colour:   c,
+				Location: location(v),
+				Texture:  r.Texture[i%len(r.Texture)],
+				Material: r.Material[i%len(r.Material)],
+				Shader:   r.Shader,
+			})
+		case sphere:
+			i := len(puzzle.Sphere)
+			c, err := colour(r, i, v)
+			if err != nil {
+				return nil, err
+			}
+			puzzle.Sphere = append(puzzle.Sphere, &perspectivego.Sphere{
+				Name:     "s" + strconv.Itoa(i),
+				Mesh:     r.Mesh[i%len(r.Mesh)],
+				Colour:   c,
+				Location: location(v),
+				Texture:  r.Texture[i%len(r.Texture)],
+				Material: r.Material[i%len(r.Material)],
+				Shader:   r.Shader,
+			})
+		case block:
+			i := len(puzzle.Block)
+			c, err := colour(r, i, v)
+			if err != nil {
+				return nil, err
+			}
+			puzzle.Block = append(puzzle.Block, &perspectivego.Block{
+				Name:     "b" + strconv.Itoa(i),
+				Mesh:     r.Mesh[i%len(r.Mesh)],
+				Colour:   c,
+				Location: location(v),
+				Texture:  r.Texture[i%len(r.Texture)],
+				Material: r.Material[i%len(r.Material)],
+				Shader:   r.Shader,
+			})
+		case portal:
+			i := len(puzzle.Portal)
+			c, err := colour(r, i/2, v)
+			if err != nil {
+				return nil, err
+			}
+			p := &perspectivego.Portal{
+				Name:     "p" + strconv.Itoa(i),
+				Mesh:     r.Mesh[i%len(r.Mesh)],
+				Colour:   c,
+				Location: location(v),
+				Texture:  r.Texture[(i/2)%len(r.Texture)],
+				Material: r.Material[(i/2)%len(r.Material)],
+				Shader:   r.Shader,
+			}
+			if pending == nil {
+				pending = p
+				pendingIndex = v.Index
+			} else {
+				if pendingIndex != v.Index {
+					return nil, fmt.Errorf("Palette index %d has an unpaired portal", pendingIndex)
+				}
+				p.Link = pending.Location
+				pending.Link = p.Location
+				pending = nil
+			}
+			puzzle.Portal = append(puzzle.Portal, p)
+		}
+	}
+	if pending != nil {
+		return nil, fmt.Errorf("Palette index %d has an unpaired portal", pendingIndex)
+	}
+	return puzzle, nil
+}